@@ -0,0 +1,83 @@
+// importlog replays logs written by the WifiLogger into the sqlite database.
+//
+//	go run ./cmd/importlog -db downtimedata.db log.txt.20240301T000000.000.gz log.txt
+//
+// Pass rotated logs oldest first and the current log last, outages are
+// matched up in the order they are replayed. Gzipped logs are read as is.
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"WifiTracker/internals/db"
+)
+
+// unparseable lines printed per file before summarising the rest
+const maxShown = 20
+
+func main() {
+	dbPath := flag.String("db", "downtimedata.db", "database to import into")
+	deviceID := flag.String("device", "", "device id to record every event under, defaults to the id in each line")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"log.txt"}
+	}
+
+	storage, err := db.NewDatabaseStorage(*dbPath)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	defer storage.Close()
+
+	failed := false
+	for _, path := range files {
+		report, err := importFile(storage, path, db.ImportOptions{DeviceID: *deviceID})
+		fmt.Printf("%s: %d lines, %d imported, %d duplicates, %d unparseable\n",
+			path, report.Lines, report.Imported, report.Duplicates, len(report.Unparseable))
+
+		for i, line := range report.Unparseable {
+			if i == maxShown {
+				fmt.Printf("  ... and %d more\n", len(report.Unparseable)-maxShown)
+				break
+			}
+			fmt.Printf("  line %d: %v: %s\n", line.Number, line.Err, line.Text)
+		}
+		if err != nil {
+			log.Printf("failed to import %s: %v", path, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		storage.Close()
+		os.Exit(1)
+	}
+}
+
+func importFile(storage *db.DatabaseStorage, path string, options db.ImportOptions) (db.ImportReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return db.ImportReport{}, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return db.ImportReport{}, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	return storage.ImportLog(r, options)
+}
@@ -0,0 +1,40 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/gen2brain/beeep"
+)
+
+// beeep keeps the app name in a global
+var beeepMu sync.Mutex
+
+// DesktopNotifier shows notifications on the desktop.
+type DesktopNotifier struct {
+	AppName string
+	// Icon is the path of the notification icon, none if empty.
+	Icon string
+}
+
+var _ Notifier = (*DesktopNotifier)(nil)
+
+func NewDesktopNotifier() *DesktopNotifier {
+	return &DesktopNotifier{
+		AppName: "WifiTracker",
+		Icon:    filepath.Join("bin", "warning.png"),
+	}
+}
+
+func (d *DesktopNotifier) Notify(ctx context.Context, notification Notification) error {
+	beeepMu.Lock()
+	defer beeepMu.Unlock()
+
+	beeep.AppName = d.AppName
+	if err := beeep.Notify(notification.Title(), notification.Message(), d.Icon); err != nil {
+		return fmt.Errorf("failed to show desktop notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p permanentError) Unwrap() error {
+	return p.err
+}
+
+// Permanent marks an error that trying again won't fix, so it is not
+// retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// Backoff retries with exponentially growing waits, doubling from Initial
+// up to Max.
+type Backoff struct {
+	// Attempts counts the first try, 1 never retries.
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Attempts: 5,
+		Initial:  time.Second,
+		Max:      time.Minute,
+	}
+}
+
+// Delay is the wait after the given failed attempt, counting from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, b.Max)
+}
+
+// Retry calls fn until it succeeds, fails permanently or runs out of
+// attempts, and returns the last error. onError sees every failed attempt.
+// ctx only cuts the waits short, the attempt in flight is left to finish.
+func (b Backoff) Retry(ctx context.Context, fn func() error, onError func(attempt int, err error)) error {
+	attempts := max(b.Attempts, 1)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil || IsPermanent(err) {
+			return err
+		}
+		if onError != nil {
+			onError(attempt, err)
+		}
+		if attempt == attempts {
+			break
+		}
+
+		timer := time.NewTimer(b.Delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+}
+
+type DispatcherConfig struct {
+	Backoff Backoff
+	// Timeout bounds a single attempt of one notifier, including whatever
+	// retrying the notifier does on its own.
+	Timeout time.Duration
+	// OnError is called for every failed attempt. The default logs it.
+	OnError func(error)
+}
+
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		Backoff: DefaultBackoff(),
+		// long enough for a webhook to go through its own retries
+		Timeout: 30 * time.Second,
+	}
+}
+
+// Dispatcher sends every notification to all of its notifiers in the
+// background. A failing or panicking notifier is retried and logged, it
+// never takes the caller down with it.
+type Dispatcher struct {
+	notifiers []Notifier
+	config    DispatcherConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewDispatcher(config DispatcherConfig, notifiers ...Notifier) *Dispatcher {
+	defaults := DefaultDispatcherConfig()
+	if config.Backoff.Attempts <= 0 {
+		config.Backoff.Attempts = defaults.Backoff.Attempts
+	}
+	if config.Backoff.Initial <= 0 {
+		config.Backoff.Initial = defaults.Backoff.Initial
+	}
+	if config.Backoff.Max <= 0 {
+		config.Backoff.Max = defaults.Backoff.Max
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Println(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		notifiers: notifiers,
+		config:    config,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Send hands the notification to every notifier and returns right away.
+func (d *Dispatcher) Send(notification Notification) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	for _, notifier := range d.notifiers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.deliver(notifier, notification)
+		}()
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(notifier Notifier, notification Notification) {
+	err := d.config.Backoff.Retry(d.ctx, func() error {
+		return d.attempt(notifier, notification)
+	}, func(attempt int, err error) {
+		d.config.OnError(fmt.Errorf("failed to send %s notification through %T (attempt %d): %w", notification.Kind, notifier, attempt, err))
+	})
+
+	// the attempts were reported one by one, this is the giving up
+	if err != nil {
+		d.config.OnError(fmt.Errorf("dropped %s notification for %s through %T: %w", notification.Kind, notification.DeviceID, notifier, err))
+	}
+}
+
+func (d *Dispatcher) attempt(notifier Notifier, notification Notification) (err error) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("notifier panicked: %v", r)
+		}
+	}()
+
+	return notifier.Notify(ctx, notification)
+}
+
+// Close stops taking notifications and waits for the pending ones to be
+// delivered or given up. Once ctx is done the pending ones are cancelled.
+func (d *Dispatcher) Close(ctx context.Context) {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
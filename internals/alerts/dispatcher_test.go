@@ -0,0 +1,132 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyNotifier fails a number of times before it succeeds.
+type flakyNotifier struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyNotifier) Notify(ctx context.Context, notification Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Attempts: 10, Initial: time.Second, Max: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 9: 5 * time.Second} {
+		if got := backoff.Delay(attempt); got != want {
+			t.Errorf("Expected a delay of %v after attempt %d, got %v", want, attempt, got)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	notification := Notification{Kind: KindOutage, DeviceID: "dev", Duration: time.Minute}
+	fast := Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond}
+
+	collect := func() (func(error), func() []error) {
+		var mu sync.Mutex
+		errs := []error{}
+		return func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			}, func() []error {
+				mu.Lock()
+				defer mu.Unlock()
+				return errs
+			}
+	}
+
+	t.Run("RetriesUntilDelivered", func(t *testing.T) {
+		onError, errs := collect()
+		notifier := &flakyNotifier{failures: 2, err: errors.New("unreachable")}
+		dispatcher := NewDispatcher(DispatcherConfig{Backoff: fast, OnError: onError}, notifier)
+
+		if err := dispatcher.Send(notification); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		dispatcher.Close(context.Background())
+
+		if notifier.calls != 3 || len(errs()) != 2 {
+			t.Errorf("Expected 2 failed attempts and a delivery, got %d calls and errors %v", notifier.calls, errs())
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		onError, errs := collect()
+		notifier := &flakyNotifier{failures: 10, err: errors.New("unreachable")}
+		dispatcher := NewDispatcher(DispatcherConfig{Backoff: fast, OnError: onError}, notifier)
+
+		dispatcher.Send(notification)
+		dispatcher.Close(context.Background())
+
+		// every attempt and the giving up
+		if notifier.calls != 3 || len(errs()) != 4 {
+			t.Errorf("Expected 3 attempts and 4 errors, got %d calls and errors %v", notifier.calls, errs())
+		}
+	})
+
+	t.Run("PermanentIsNotRetried", func(t *testing.T) {
+		onError, errs := collect()
+		notifier := &flakyNotifier{failures: 10, err: Permanent(errors.New("bad request"))}
+		dispatcher := NewDispatcher(DispatcherConfig{Backoff: fast, OnError: onError}, notifier)
+
+		dispatcher.Send(notification)
+		dispatcher.Close(context.Background())
+
+		if notifier.calls != 1 || len(errs()) != 1 || !IsPermanent(errs()[0]) {
+			t.Errorf("Expected one attempt and one permanent error, got %d calls and errors %v", notifier.calls, errs())
+		}
+	})
+
+	t.Run("CloseStopsRetrying", func(t *testing.T) {
+		onError, _ := collect()
+		notifier := &flakyNotifier{failures: 10, err: errors.New("unreachable")}
+		slow := Backoff{Attempts: 5, Initial: time.Hour, Max: time.Hour}
+		dispatcher := NewDispatcher(DispatcherConfig{Backoff: slow, OnError: onError}, notifier)
+
+		dispatcher.Send(notification)
+		closed := make(chan struct{})
+		go func() {
+			// let the first attempt fail before closing
+			for {
+				notifier.mu.Lock()
+				calls := notifier.calls
+				notifier.mu.Unlock()
+				if calls > 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			dispatcher.Close(ctx)
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("Expected Close to cut the backoff short once its context is done")
+		}
+		if err := dispatcher.Send(notification); !errors.Is(err, ErrDispatcherClosed) {
+			t.Errorf("Expected ErrDispatcherClosed after Close, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// kinds of Notification
+const (
+	KindOutage         = "outage"
+	KindLatencyAnomaly = "latency_anomaly"
+	KindFlapping       = "flapping"
+)
+
+// Notification is an event someone should hear about. Only the fields of
+// its kind are set.
+type Notification struct {
+	Kind     string
+	DeviceID string
+	// Device is the display name of the device.
+	Device string
+	// Targets are the probe targets affected, the ones that stopped
+	// answering for an outage and the ones slower than the baseline for an
+	// anomaly.
+	Targets []string
+
+	// outages and flapping, Start is also when an anomaly began
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	// Transitions is how many times the status changed while flapping.
+	Transitions int
+
+	// latency anomalies, the last minute against the usual for the time
+	Latency  time.Duration
+	Expected time.Duration
+}
+
+// Notifier delivers notifications somewhere. Notify should give up when ctx
+// is done, retrying is up to the Dispatcher.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+func (n Notification) Title() string {
+	switch n.Kind {
+	case KindOutage:
+		return "Wifi Down"
+	case KindLatencyAnomaly:
+		return "Wifi Degraded"
+	case KindFlapping:
+		return "Wifi Unstable"
+	}
+	return "WifiTracker"
+}
+
+func (n Notification) Message() string {
+	switch n.Kind {
+	case KindOutage:
+		return fmt.Sprintf("%s had an outage that lasted %s", n.Device, n.Duration.Round(time.Second))
+	case KindLatencyAnomaly:
+		return fmt.Sprintf("Latency on %s is %dms, it is usually around %dms at this time", n.Device, n.Latency.Milliseconds(), n.Expected.Milliseconds())
+	case KindFlapping:
+		return fmt.Sprintf("%s kept dropping, its status changed %d times over %s", n.Device, n.Transitions, n.Duration.Round(time.Second))
+	}
+	return fmt.Sprintf("%s: %s", n.Device, n.Kind)
+}
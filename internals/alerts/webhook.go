@@ -0,0 +1,290 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"WifiTracker/util"
+
+	"github.com/google/uuid"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the request body as
+// "sha256=<hex>" when a secret is configured.
+const SignatureHeader = "X-WifiTracker-Signature"
+
+type WebhookConfig struct {
+	URLs []string
+	// Headers are added to every request, e.g. an Authorization header.
+	Headers map[string]string
+	// Secret signs the body, see SignatureHeader.
+	Secret string
+	// Timeout bounds a single request.
+	Timeout time.Duration
+	// Backoff retries each URL on network errors, 408, 429 and 5xx
+	// responses. Other responses are not retried.
+	Backoff Backoff
+	// DeadLetter is a file that gets every payload a URL did not take, one
+	// JSON line each. Nothing is kept if empty.
+	DeadLetter string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		Timeout: 5 * time.Second,
+		Backoff: Backoff{Attempts: 4, Initial: 500 * time.Millisecond, Max: 5 * time.Second},
+	}
+}
+
+// WebhookPayload is the JSON body POSTed for a notification. Durations and
+// latencies are in milliseconds, Transitions counts the status changes of a
+// flap. ID is the same for every retry of a
+// delivery, receivers can use it to drop duplicates.
+type WebhookPayload struct {
+	ID          string        `json:"id"`
+	Event       string        `json:"event"`
+	Device      WebhookDevice `json:"device"`
+	Start       *time.Time    `json:"start,omitempty"`
+	End         *time.Time    `json:"end,omitempty"`
+	Duration    float64       `json:"duration_ms,omitempty"`
+	Transitions int           `json:"transitions,omitempty"`
+	Targets     []string      `json:"targets,omitempty"`
+	Latency     float64       `json:"latency_ms,omitempty"`
+	Expected    float64       `json:"expected_ms,omitempty"`
+	Message     string        `json:"message"`
+}
+
+type WebhookDevice struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// deadLetter is one line of the dead-letter log.
+type deadLetter struct {
+	URL      string          `json:"url"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// WebhookNotifier POSTs notifications to every configured URL. It does its
+// own retrying per URL, so one URL failing does not resend to the others,
+// and reports its failures as permanent to the Dispatcher.
+type WebhookNotifier struct {
+	config WebhookConfig
+	client *http.Client
+
+	deadLetterMu sync.Mutex
+}
+
+var _ Notifier = (*WebhookNotifier)(nil)
+
+func NewWebhookNotifier(config WebhookConfig) (*WebhookNotifier, error) {
+	if len(config.URLs) == 0 {
+		return nil, errors.New("webhook needs at least one url")
+	}
+	for _, raw := range config.URLs {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook url %q: %w", raw, err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("webhook url %q must be http or https", raw)
+		}
+	}
+
+	defaults := DefaultWebhookConfig()
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.Backoff.Attempts <= 0 {
+		config.Backoff.Attempts = defaults.Backoff.Attempts
+	}
+	if config.Backoff.Initial <= 0 {
+		config.Backoff.Initial = defaults.Backoff.Initial
+	}
+	if config.Backoff.Max <= 0 {
+		config.Backoff.Max = defaults.Backoff.Max
+	}
+
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookNotifier{config: config, client: client}, nil
+}
+
+func NewWebhookPayload(notification Notification) WebhookPayload {
+	payload := WebhookPayload{
+		ID:          uuid.NewString(),
+		Event:       notification.Kind,
+		Device:      WebhookDevice{ID: notification.DeviceID, Name: notification.Device},
+		Duration:    util.DurationMs(notification.Duration),
+		Transitions: notification.Transitions,
+		Targets:     notification.Targets,
+		Latency:     util.DurationMs(notification.Latency),
+		Expected:    util.DurationMs(notification.Expected),
+		Message:     notification.Message(),
+	}
+	if !notification.Start.IsZero() {
+		start := notification.Start.UTC()
+		payload.Start = &start
+	}
+	if !notification.End.IsZero() {
+		end := notification.End.UTC()
+		payload.End = &end
+	}
+	return payload
+}
+
+// Sign is the value of SignatureHeader for a body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify delivers to every URL concurrently. A URL that still fails after
+// its retries, or once ctx is done, is dead-lettered.
+func (w *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(NewWebhookPayload(notification))
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to encode webhook payload: %w", err))
+	}
+
+	errs := make([]error, len(w.config.URLs))
+	var wg sync.WaitGroup
+	for i, target := range w.config.URLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := w.config.Backoff.Retry(ctx, func() error {
+				return w.post(ctx, target, body)
+			}, nil)
+			if err == nil {
+				return
+			}
+			errs[i] = fmt.Errorf("webhook %s: %w", target, err)
+			if dlErr := w.deadLetter(target, body, err); dlErr != nil {
+				errs[i] = errors.Join(errs[i], dlErr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// retried and dead-lettered already, the dispatcher should not resend
+	return Permanent(errors.Join(errs...))
+}
+
+func (w *WebhookNotifier) post(ctx context.Context, target string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range w.config.Headers {
+		request.Header.Set(name, value)
+	}
+	if w.config.Secret != "" {
+		request.Header.Set(SignatureHeader, Sign(w.config.Secret, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// drain so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	status := response.StatusCode
+	switch {
+	case status >= 200 && status < 300:
+		return nil
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+		return fmt.Errorf("unexpected status %s", response.Status)
+	default:
+		return Permanent(fmt.Errorf("unexpected status %s", response.Status))
+	}
+}
+
+func (w *WebhookNotifier) deadLetter(target string, body []byte, cause error) error {
+	if w.config.DeadLetter == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(deadLetter{URL: target, Error: cause.Error(), FailedAt: time.Now().UTC(), Payload: body})
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+
+	w.deadLetterMu.Lock()
+	defer w.deadLetterMu.Unlock()
+
+	file, err := os.OpenFile(w.config.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter log: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+// webhookFile is the JSON form of a WebhookConfig.
+type webhookFile struct {
+	URLs    []string          `json:"urls"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Secret  string            `json:"secret,omitempty"`
+	// Timeout is a Go duration like "5s".
+	Timeout    string `json:"timeout,omitempty"`
+	DeadLetter string `json:"dead_letter,omitempty"`
+}
+
+// LoadWebhookConfig reads a webhook config file. A missing file is not an
+// error, it just means no webhooks.
+func LoadWebhookConfig(path string) (WebhookConfig, bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return WebhookConfig{}, false, nil
+	}
+	if err != nil {
+		return WebhookConfig{}, false, fmt.Errorf("failed to read webhook file %s: %w", path, err)
+	}
+
+	var file webhookFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return WebhookConfig{}, false, fmt.Errorf("failed to parse webhook file %s: %w", path, err)
+	}
+
+	config := DefaultWebhookConfig()
+	config.URLs = file.URLs
+	config.Headers = file.Headers
+	config.Secret = file.Secret
+	config.DeadLetter = file.DeadLetter
+	if file.Timeout != "" {
+		if config.Timeout, err = time.ParseDuration(file.Timeout); err != nil {
+			return WebhookConfig{}, false, fmt.Errorf("invalid webhook timeout %q: %w", file.Timeout, err)
+		}
+	}
+	return config, true, nil
+}
@@ -0,0 +1,207 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	notification := Notification{
+		Kind:     KindOutage,
+		DeviceID: "dev",
+		Device:   "Laptop",
+		Targets:  []string{"8.8.8.8", "1.1.1.1"},
+		Start:    start,
+		End:      start.Add(90 * time.Second),
+		Duration: 90 * time.Second,
+	}
+	fast := Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond}
+
+	t.Run("SignedPayload", func(t *testing.T) {
+		var (
+			body      []byte
+			signature string
+			token     string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			signature = r.Header.Get(SignatureHeader)
+			token = r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		notifier, err := NewWebhookNotifier(WebhookConfig{
+			URLs:    []string{server.URL},
+			Headers: map[string]string{"Authorization": "Bearer token"},
+			Secret:  "secret",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create notifier: %v", err)
+		}
+		if err := notifier.Notify(context.Background(), notification); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+
+		if signature != Sign("secret", body) || token != "Bearer token" {
+			t.Errorf("Expected a signed request with the custom header, got %q and %q", signature, token)
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		if payload.Event != KindOutage || payload.Device.ID != "dev" || payload.Duration != 90000 || len(payload.Targets) != 2 || payload.ID == "" {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+		if !payload.Start.Equal(start) || !payload.End.Equal(start.Add(90*time.Second)) {
+			t.Errorf("Expected the outage span, got %v - %v", payload.Start, payload.End)
+		}
+	})
+
+	t.Run("RetriesServerErrors", func(t *testing.T) {
+		var (
+			mu    sync.Mutex
+			calls int
+			ids   = map[string]bool{}
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload WebhookPayload
+			json.NewDecoder(r.Body).Decode(&payload)
+
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			ids[payload.ID] = true
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		notifier, _ := NewWebhookNotifier(WebhookConfig{URLs: []string{server.URL}, Backoff: fast})
+		if err := notifier.Notify(context.Background(), notification); err != nil {
+			t.Fatalf("Expected the third attempt to go through, got: %v", err)
+		}
+		if calls != 3 || len(ids) != 1 {
+			t.Errorf("Expected 3 attempts of the same delivery, got %d with %d ids", calls, len(ids))
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := map[string]int{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls[r.URL.Path]++
+			mu.Unlock()
+
+			switch r.URL.Path {
+			case "/down":
+				w.WriteHeader(http.StatusBadGateway)
+			case "/rejected":
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		deadLetters := filepath.Join(t.TempDir(), "dead.jsonl")
+		notifier, _ := NewWebhookNotifier(WebhookConfig{
+			URLs:       []string{server.URL + "/ok", server.URL + "/down", server.URL + "/rejected"},
+			Backoff:    fast,
+			DeadLetter: deadLetters,
+		})
+
+		err := notifier.Notify(context.Background(), notification)
+		if err == nil || !IsPermanent(err) {
+			t.Fatalf("Expected a permanent error for the failed urls, got: %v", err)
+		}
+		// only the server errors are retried
+		if calls["/ok"] != 1 || calls["/down"] != 3 || calls["/rejected"] != 1 {
+			t.Errorf("Unexpected attempts per url: %v", calls)
+		}
+
+		content, err := os.ReadFile(deadLetters)
+		if err != nil {
+			t.Fatalf("Failed to read dead letters: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 dead letters, got %d", len(lines))
+		}
+		for _, line := range lines {
+			var letter deadLetter
+			if err := json.Unmarshal([]byte(line), &letter); err != nil {
+				t.Fatalf("Failed to decode dead letter: %v", err)
+			}
+			var payload WebhookPayload
+			if err := json.Unmarshal(letter.Payload, &payload); err != nil || payload.Device.ID != "dev" {
+				t.Errorf("Expected the payload in the dead letter, got %s", letter.Payload)
+			}
+			if strings.HasSuffix(letter.URL, "/ok") {
+				t.Errorf("Expected the delivered url not to be dead-lettered")
+			}
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		notifier, _ := NewWebhookNotifier(WebhookConfig{
+			URLs:    []string{server.URL},
+			Timeout: 10 * time.Millisecond,
+			Backoff: Backoff{Attempts: 2, Initial: time.Millisecond, Max: time.Millisecond},
+		})
+
+		began := time.Now()
+		if err := notifier.Notify(context.Background(), notification); err == nil {
+			t.Fatal("Expected the hanging server to time out")
+		}
+		if elapsed := time.Since(began); elapsed > time.Second {
+			t.Errorf("Expected the timeout to cut the requests short, took %v", elapsed)
+		}
+	})
+
+	t.Run("InvalidURL", func(t *testing.T) {
+		if _, err := NewWebhookNotifier(WebhookConfig{URLs: []string{"ftp://example.com"}}); err == nil {
+			t.Error("Expected a non http url to be rejected")
+		}
+		if _, err := NewWebhookNotifier(WebhookConfig{}); err == nil {
+			t.Error("Expected a webhook without urls to be rejected")
+		}
+	})
+
+	t.Run("LoadConfig", func(t *testing.T) {
+		dir := t.TempDir()
+		if _, ok, err := LoadWebhookConfig(filepath.Join(dir, "missing.json")); ok || err != nil {
+			t.Errorf("Expected a missing file to mean no webhooks, got ok=%v err=%v", ok, err)
+		}
+
+		path := filepath.Join(dir, "webhooks.json")
+		os.WriteFile(path, []byte(`{"urls": ["https://example.com/hook"], "secret": "s", "timeout": "2s", "dead_letter": "dead.jsonl"}`), 0644)
+		config, ok, err := LoadWebhookConfig(path)
+		if !ok || err != nil {
+			t.Fatalf("Failed to load webhook config: %v", err)
+		}
+		if config.URLs[0] != "https://example.com/hook" || config.Timeout != 2*time.Second || config.DeadLetter != "dead.jsonl" || config.Backoff.Attempts == 0 {
+			t.Errorf("Unexpected config %+v", config)
+		}
+	})
+}
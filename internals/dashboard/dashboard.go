@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"time"
 
-	"WifiTracker/internals/db"
 	"WifiTracker/internals/monitor"
 	"WifiTracker/util"
 
@@ -20,7 +19,6 @@ import (
 // scrape potential downtimes and attribute them
 // add measures of seveity
 // maintenance windows
-// custom webhooks perhaps
 // group related notifications if in a certain time period
 // have messages ready for teams / groupchats after down time
 // metrics export feature
@@ -33,42 +31,31 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func WebsocketHandler(w http.ResponseWriter, r *http.Request) {
-	// upgrade
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
-		http.Error(w, "WebSocket upgrade failed", http.StatusBadRequest)
-		return
-	}
-	defer conn.Close()
-
-	log.Println("WebSocket connection established")
-
-	storage, err := db.NewDatabaseStorage("downtimedata.db")
-	if err != nil {
-		panic(err)
-	}
+// WebsocketHandler streams the device status and downtimes read from storage.
+func WebsocketHandler(storage monitor.StorageReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// upgrade
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade error: %v", err)
+			http.Error(w, "WebSocket upgrade failed", http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
 
-	storage.LogOutageStart("bbed78db-4aa8-46bc-930e-e689aabf5eb0", time.Now())
-	storage.LogOutageEnd("bbed78db-4aa8-46bc-930e-e689aabf5eb0", time.Minute, time.Now())
+		log.Println("WebSocket connection established")
 
-	// create the database connection
-	downtimeStorage, err := db.NewDatabaseStorage("downtimedata.db")
-	if err != nil {
-		log.Fatalf("Error opening database: %v\n", err)
+		streamDeviceData(conn, storage)
 	}
+}
 
+func streamDeviceData(conn *websocket.Conn, storage monitor.StorageReader) {
 	for {
 
 		deviceData := monitor.GetAllDeviceData()
-		dayDowntime := DowntimeErrorCheck(downtimeStorage, util.OneDayAgo())
-		weekDowntime := DowntimeErrorCheck(downtimeStorage, util.OneWeekAgo())
-		monthDowntime := DowntimeErrorCheck(downtimeStorage, util.OneMonthAgo())
-
-		// log.Printf("Data:\nDay: %+v\nWeek: %+v\nMonth: %+v\n", dayDowntime, weekDowntime, monthDowntime)
 
 		if len(deviceData) == 0 {
+			time.Sleep(time.Second)
 			continue
 		}
 
@@ -77,15 +64,31 @@ func WebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		// experimental for now
 		firstValue := deviceData[0]
 
+		dayDowntime := DowntimeErrorCheck(storage, firstValue.DeviceID, util.OneDayAgo())
+		weekDowntime := DowntimeErrorCheck(storage, firstValue.DeviceID, util.OneWeekAgo())
+		monthDowntime := DowntimeErrorCheck(storage, firstValue.DeviceID, util.OneMonthAgo())
+
+		// log.Printf("Data:\nDay: %+v\nWeek: %+v\nMonth: %+v\n", dayDowntime, weekDowntime, monthDowntime)
+
 		valuesOver := struct {
+			DeviceID       string
+			Name           string
 			Online         string
 			Latency        string
-			DayDowntimes   []db.DowntimeEvent
-			WeekDowntimes  []db.DowntimeEvent
-			MonthDowntimes []db.DowntimeEvent
+			Latency1m      string
+			Latency5m      string
+			Latency1h      string
+			DayDowntimes   []monitor.OutageRecord
+			WeekDowntimes  []monitor.OutageRecord
+			MonthDowntimes []monitor.OutageRecord
 		}{
+			DeviceID:       firstValue.DeviceID,
+			Name:           firstValue.Name,
 			Online:         firstValue.Online,
 			Latency:        firstValue.Latency,
+			Latency1m:      firstValue.Latency1m,
+			Latency5m:      firstValue.Latency5m,
+			Latency1h:      firstValue.Latency1h,
 			DayDowntimes:   dayDowntime,
 			WeekDowntimes:  weekDowntime,
 			MonthDowntimes: monthDowntime,
@@ -102,8 +105,11 @@ func WebsocketHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func DowntimeErrorCheck(db *db.DatabaseStorage, ts time.Time) []db.DowntimeEvent {
-	result, err := db.GetDowntimes(ts)
+func DowntimeErrorCheck(storage monitor.StorageReader, deviceID string, ts time.Time) []monitor.OutageRecord {
+	result, err := storage.GetOutages(monitor.OutageQuery{
+		DeviceIDs: []string{deviceID},
+		From:      ts,
+	})
 	if err != nil {
 		log.Printf("Error fetching downtimes: %v", err)
 		return nil
@@ -111,12 +117,12 @@ func DowntimeErrorCheck(db *db.DatabaseStorage, ts time.Time) []db.DowntimeEvent
 	return result
 }
 
-func StartDashboard() {
+func StartDashboard(storage monitor.StorageReader) {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "index.html")
 	})
 
-	http.HandleFunc("/ws", WebsocketHandler)
+	http.HandleFunc("/ws", WebsocketHandler(storage))
 
 	http.ListenAndServe("localhost:8080", nil)
 }
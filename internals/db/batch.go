@@ -0,0 +1,286 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"WifiTracker/internals/monitor"
+)
+
+var (
+	ErrQueueFull    = errors.New("write queue is full")
+	ErrWriterClosed = errors.New("batch writer is closed")
+)
+
+// OverflowPolicy decides what happens to a write when the queue is full.
+type OverflowPolicy int
+
+const (
+	// Block waits up to BlockTimeout for room in the queue, slowing the
+	// caller down, then drops the write like DropNewest.
+	Block OverflowPolicy = iota
+	// DropNewest discards the write and returns ErrQueueFull.
+	DropNewest
+)
+
+type BatchConfig struct {
+	// a batch is committed when it holds BatchSize writes or FlushInterval
+	// passed since the last commit, whichever comes first
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	Overflow      OverflowPolicy
+	// BlockTimeout bounds how long Block waits, so a stuck disk can't stall
+	// the monitor for good.
+	BlockTimeout time.Duration
+	// OnError receives errors of writes that were already queued, the
+	// callers have returned by then, and writes Block gave up on. Defaults
+	// to log.Println.
+	OnError func(error)
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		QueueSize:     1000,
+		Overflow:      Block,
+		BlockTimeout:  5 * time.Second,
+	}
+}
+
+// BatchWriter queues writes to a DatabaseStorage and commits them in
+// transactions from a background goroutine, so a slow disk doesn't hold up
+// the monitor. Reads go straight to the database and only see committed
+// writes.
+type BatchWriter struct {
+	*DatabaseStorage
+
+	config  BatchConfig
+	queue   chan writeOp
+	flushes chan chan error
+	done    chan struct{}
+
+	// closing takes the write lock, every send holds the read lock
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+}
+
+var (
+	_ monitor.Storage        = (*BatchWriter)(nil)
+	_ monitor.Flusher        = (*BatchWriter)(nil)
+	_ monitor.OutageRecovery = (*BatchWriter)(nil)
+)
+
+func NewBatchWriter(storage *DatabaseStorage, config BatchConfig) *BatchWriter {
+	defaults := DefaultBatchConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.BlockTimeout <= 0 {
+		config.BlockTimeout = defaults.BlockTimeout
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Println("failed to write batch:", err)
+		}
+	}
+
+	b := &BatchWriter{
+		DatabaseStorage: storage,
+		config:          config,
+		queue:           make(chan writeOp, config.QueueSize),
+		flushes:         make(chan chan error),
+		done:            make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *BatchWriter) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	return b.enqueue(connectivityCheckOp(deviceID, success, responseTime, timestamp, err))
+}
+
+func (b *BatchWriter) LogStatusChange(deviceID string, from, to monitor.ConnectionStatus, timestamp time.Time) error {
+	return b.enqueue(statusChangeOp(deviceID, from, to, timestamp))
+}
+
+func (b *BatchWriter) LogOutageStart(deviceID string, timestamp time.Time) error {
+	return b.enqueue(outageStartOp(deviceID, timestamp))
+}
+
+func (b *BatchWriter) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
+	return b.enqueue(outageEndOp(deviceID, duration, timestamp))
+}
+
+func (b *BatchWriter) LogProbeStats(deviceID string, target string, stats monitor.ProbeStats, timestamp time.Time) error {
+	return b.enqueue(probeStatsOp(deviceID, target, stats, timestamp))
+}
+
+func (b *BatchWriter) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	return b.enqueue(flapIncidentOp(deviceID, start, end, transitions))
+}
+
+func (b *BatchWriter) LogLatencyAnomaly(deviceID string, anomaly monitor.LatencyAnomaly) error {
+	return b.enqueue(latencyAnomalyOp(deviceID, anomaly))
+}
+
+// queued as well so it stays ordered with the outage writes around it
+func (b *BatchWriter) MarkOutageInterrupted(deviceID string) error {
+	return b.enqueue(writeOp{"markOutageInterrupted", []any{deviceID}})
+}
+
+// Dropped is the number of writes discarded because the queue was full.
+func (b *BatchWriter) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+func (b *BatchWriter) enqueue(op writeOp) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrWriterClosed
+	}
+
+	if b.config.Overflow == DropNewest {
+		select {
+		case b.queue <- op:
+			return nil
+		default:
+			b.dropped.Add(1)
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case b.queue <- op:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(b.config.BlockTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- op:
+		return nil
+	case <-timer.C:
+		b.dropped.Add(1)
+		b.config.OnError(fmt.Errorf("dropped %s write after waiting %v: %w", op.stmt, b.config.BlockTimeout, ErrQueueFull))
+		return ErrQueueFull
+	}
+}
+
+// Flush commits everything queued so far and returns the error of that
+// commit.
+func (b *BatchWriter) Flush() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrWriterClosed
+	}
+
+	reply := make(chan error, 1)
+	b.flushes <- reply
+	return <-reply
+}
+
+// Close commits the queued writes and closes the database.
+func (b *BatchWriter) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrWriterClosed
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	<-b.done
+	return b.DatabaseStorage.Close()
+}
+
+func (b *BatchWriter) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]writeOp, 0, b.config.BatchSize)
+	commit := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := b.commit(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case op, ok := <-b.queue:
+			if !ok {
+				b.report(commit())
+				return
+			}
+			batch = append(batch, op)
+			if len(batch) >= b.config.BatchSize {
+				b.report(commit())
+			}
+
+		case <-ticker.C:
+			b.report(commit())
+
+		case reply := <-b.flushes:
+			// only this goroutine receives, so everything counted is there
+			for n := len(b.queue); n > 0; n-- {
+				batch = append(batch, <-b.queue)
+			}
+			reply <- commit()
+		}
+	}
+}
+
+// commit writes the batch in one transaction. A failing write doesn't stop
+// the rest of the batch, its error is returned with the others.
+func (b *BatchWriter) commit(batch []writeOp) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin batch of %d writes: %w", len(batch), err)
+	}
+
+	stmts := make(map[string]*sql.Stmt)
+	var errs []error
+	for _, op := range batch {
+		stmt, ok := stmts[op.stmt]
+		if !ok {
+			stmt = tx.Stmt(b.stmts[op.stmt])
+			stmts[op.stmt] = stmt
+		}
+		if _, err := stmt.Exec(op.args...); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", op.stmt, err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch of %d writes: %w", len(batch), err)
+	}
+	return errors.Join(errs...)
+}
+
+func (b *BatchWriter) report(err error) {
+	if err != nil {
+		b.config.OnError(err)
+	}
+}
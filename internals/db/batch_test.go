@@ -0,0 +1,114 @@
+package db
+
+import (
+	"WifiTracker/internals/monitor"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBatchWriter(t *testing.T) {
+	deviceID := "bbed78db-4aa8-46bc-930e-e689aabf5eb0"
+	now := time.Now().Truncate(time.Second)
+
+	t.Run("FlushCommitsQueuedWrites", func(t *testing.T) {
+		dbStorage := newTestStorage(t)
+		writer := NewBatchWriter(dbStorage, BatchConfig{BatchSize: 1000, FlushInterval: time.Hour})
+		defer writer.Close()
+
+		for i := 0; i < 10; i++ {
+			if err := writer.LogConnectivityCheck(deviceID, true, 20*time.Millisecond, now.Add(time.Duration(i)*time.Second), nil); err != nil {
+				t.Fatalf("Failed to queue check: %v", err)
+			}
+		}
+		writer.LogOutageStart(deviceID, now)
+		writer.LogOutageEnd(deviceID, time.Minute, now.Add(time.Minute))
+
+		if err := writer.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+
+		checks, err := writer.GetChecks(deviceID, now, now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to fetch checks: %v", err)
+		}
+		if len(checks) != 10 {
+			t.Errorf("Expected 10 checks after flush, got %d", len(checks))
+		}
+
+		outages, err := writer.GetOutages(monitor.OutageQuery{})
+		if err != nil {
+			t.Fatalf("Failed to fetch outages: %v", err)
+		}
+		if len(outages) != 1 || outages[0].Open() {
+			t.Errorf("Expected 1 closed outage, got %+v", outages)
+		}
+	})
+
+	t.Run("CloseFlushes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		dbStorage := openTestStorage(t, path)
+		writer := NewBatchWriter(dbStorage, BatchConfig{BatchSize: 1000, FlushInterval: time.Hour})
+		writer.LogStatusChange(deviceID, monitor.Running, monitor.Down, now)
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+
+		if err := writer.LogStatusChange(deviceID, monitor.Down, monitor.Running, now); !errors.Is(err, ErrWriterClosed) {
+			t.Errorf("Expected ErrWriterClosed after close, got %v", err)
+		}
+
+		reopened := openTestStorage(t, path)
+
+		changes, err := reopened.GetStatusChanges(deviceID, now, now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to fetch status changes: %v", err)
+		}
+		if len(changes) != 1 {
+			t.Errorf("Expected the queued status change to survive close, got %d", len(changes))
+		}
+	})
+
+	t.Run("DropNewestWhenFull", func(t *testing.T) {
+		// not started, nothing drains the queue
+		writer := &BatchWriter{
+			config: BatchConfig{Overflow: DropNewest},
+			queue:  make(chan writeOp, 2),
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := writer.LogOutageStart(deviceID, now); err != nil {
+				t.Fatalf("Failed to queue write %d: %v", i, err)
+			}
+		}
+		if err := writer.LogOutageStart(deviceID, now); !errors.Is(err, ErrQueueFull) {
+			t.Errorf("Expected ErrQueueFull, got %v", err)
+		}
+		if writer.Dropped() != 1 {
+			t.Errorf("Expected 1 dropped write, got %d", writer.Dropped())
+		}
+	})
+
+	t.Run("BlockGivesUp", func(t *testing.T) {
+		var reported []error
+		writer := &BatchWriter{
+			config: BatchConfig{
+				Overflow:     Block,
+				BlockTimeout: 10 * time.Millisecond,
+				OnError:      func(err error) { reported = append(reported, err) },
+			},
+			queue: make(chan writeOp, 1),
+		}
+
+		if err := writer.LogOutageStart(deviceID, now); err != nil {
+			t.Fatalf("Failed to queue write: %v", err)
+		}
+		if err := writer.LogOutageStart(deviceID, now); !errors.Is(err, ErrQueueFull) {
+			t.Errorf("Expected ErrQueueFull once the wait runs out, got %v", err)
+		}
+		if writer.Dropped() != 1 || len(reported) != 1 {
+			t.Errorf("Expected the dropped write to be counted and reported, got %d and %v", writer.Dropped(), reported)
+		}
+	})
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"WifiTracker/internals/monitor"
@@ -10,22 +12,23 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// storage interface
-type Storage interface {
-	LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error
-	LogStatusChange(deviceID string, from, to monitor.ConnectionStatus, timestamp time.Time) error
-	LogOutageStart(deviceID string, timestamp time.Time) error
-	LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error
-	Close() error
-}
-
+// DatabaseStorage is the SQLite backend of monitor.Storage. Timestamps are
+// stored in UTC so they compare correctly as text.
 type DatabaseStorage struct {
 	db    *sql.DB
 	stmts map[string]*sql.Stmt
 }
 
+var _ monitor.Storage = (*DatabaseStorage)(nil)
+
 func NewDatabaseStorage(dbPath string) (*DatabaseStorage, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// WAL lets the dashboard read while the monitor writes, the busy timeout
+	// covers the short moments a batch holds the write lock
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite3", dbPath+separator+"_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -41,7 +44,7 @@ func NewDatabaseStorage(dbPath string) (*DatabaseStorage, error) {
 	}
 
 	// databse schema
-	if err := storage.runMigrations(); err != nil {
+	if err := migrate(db, migrations); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
@@ -55,49 +58,24 @@ func NewDatabaseStorage(dbPath string) (*DatabaseStorage, error) {
 	return storage, nil
 }
 
-func (d *DatabaseStorage) runMigrations() error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS connectivity_checks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			device_id TEXT NOT NULL,
-			success BOOLEAN NOT NULL,
-			response_time INTEGER, -- milliseconds
-			timestamp DATETIME NOT NULL,
-			error TEXT
-		)`,
-		`CREATE TABLE IF NOT EXISTS status_changes (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			device_id TEXT NOT NULL,
-			from_status TEXT NOT NULL,
-			to_status TEXT NOT NULL,
-			timestamp DATETIME NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS outages (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			device_id TEXT NOT NULL,
-			start_time DATETIME NOT NULL,
-			end_time DATETIME,
-			duration INTEGER -- milliseconds
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_connectivity_device_time ON connectivity_checks(device_id, timestamp)`,
-		`CREATE INDEX IF NOT EXISTS idx_status_device_time ON status_changes(device_id, timestamp)`,
-		`CREATE INDEX IF NOT EXISTS idx_outages_device_time ON outages(device_id, start_time)`,
-	}
-
-	for _, migration := range migrations {
-		if _, err := d.db.Exec(migration); err != nil {
-			return fmt.Errorf("failed to execute migration: %w", err)
-		}
-	}
-	return nil
-}
-
 func (d *DatabaseStorage) prepareStatements() error {
 	statements := map[string]string{
 		"insertConnectivityCheck": `INSERT INTO connectivity_checks (device_id, success, response_time, timestamp, error) VALUES (?, ?, ?, ?, ?)`,
 		"insertStatusChange":      `INSERT INTO status_changes (device_id, from_status, to_status, timestamp) VALUES (?, ?, ?, ?)`,
 		"insertOutageStart":       `INSERT INTO outages (device_id, start_time) VALUES (?, ?)`,
 		"updateOutageEnd":         `UPDATE outages SET end_time = ?, duration = ? WHERE device_id = ? AND end_time IS NULL`,
+		"upsertDevice":            `INSERT INTO devices (id, name, location, labels, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO UPDATE SET name = excluded.name, location = excluded.location, labels = excluded.labels, last_seen = excluded.last_seen`,
+		"selectDevices":           `SELECT id, name, location, labels FROM devices ORDER BY COALESCE(name, id)`,
+		"selectChecks":            `SELECT device_id, success, response_time, timestamp, error FROM connectivity_checks WHERE (? = '' OR device_id = ?) AND timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		"selectStatusChanges":     `SELECT device_id, from_status, to_status, timestamp FROM status_changes WHERE (? = '' OR device_id = ?) AND timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		"selectOpenOutage":        `SELECT start_time FROM outages WHERE device_id = ? AND end_time IS NULL ORDER BY start_time DESC LIMIT 1`,
+		"selectOldestCheck":       `SELECT timestamp FROM connectivity_checks WHERE timestamp < ? ORDER BY timestamp LIMIT 1`,
+		"selectRollups":           `SELECT device_id, resolution, bucket, count, failures, min_latency, avg_latency, max_latency, p95_latency FROM check_rollups WHERE (? = '' OR device_id = ?) AND resolution = ? AND bucket >= ? AND bucket < ? ORDER BY bucket, device_id`,
+		"selectLastCheck":         `SELECT timestamp FROM connectivity_checks WHERE device_id = ? ORDER BY timestamp DESC LIMIT 1`,
+		"markOutageInterrupted":   `UPDATE outages SET interrupted = 1 WHERE device_id = ? AND end_time IS NULL`,
+		"insertFlapIncident":      `INSERT INTO flap_incidents (device_id, start_time, end_time, transitions) VALUES (?, ?, ?, ?)`,
+		"insertLatencyAnomaly":    `INSERT INTO latency_anomalies (device_id, timestamp, latency, expected, p95, expected_p95, score) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"insertProbeStats":        `INSERT INTO probe_stats (device_id, target, sent, received, loss, min_rtt, avg_rtt, max_rtt, jitter, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	}
 
 	for name, query := range statements {
@@ -110,67 +88,345 @@ func (d *DatabaseStorage) prepareStatements() error {
 	return nil
 }
 
-func (d *DatabaseStorage) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+// writeOp is one prepared write, either executed right away or queued by
+// the BatchWriter.
+type writeOp struct {
+	stmt string
+	args []any
+}
+
+func connectivityCheckOp(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) writeOp {
 	var errStr string
 	if err != nil {
 		errStr = err.Error()
 	}
 
 	responseTimeMs := responseTime.Milliseconds()
+	return writeOp{"insertConnectivityCheck", []any{deviceID, success, responseTimeMs, timestamp.UTC(), errStr}}
+}
+
+func statusChangeOp(deviceID string, from, to monitor.ConnectionStatus, timestamp time.Time) writeOp {
+	return writeOp{"insertStatusChange", []any{deviceID, from.String(), to.String(), timestamp.UTC()}}
+}
+
+func outageStartOp(deviceID string, timestamp time.Time) writeOp {
+	return writeOp{"insertOutageStart", []any{deviceID, timestamp.UTC()}}
+}
+
+func outageEndOp(deviceID string, duration time.Duration, timestamp time.Time) writeOp {
+	durationMs := duration.Milliseconds()
+	return writeOp{"updateOutageEnd", []any{timestamp.UTC(), durationMs, deviceID}}
+}
 
-	_, execErr := d.stmts["insertConnectivityCheck"].Exec(
+func probeStatsOp(deviceID string, target string, stats monitor.ProbeStats, timestamp time.Time) writeOp {
+	return writeOp{"insertProbeStats", []any{
 		deviceID,
-		success,
-		responseTimeMs,
-		timestamp,
-		errStr,
-	)
+		target,
+		stats.Sent,
+		stats.Received,
+		stats.Loss,
+		stats.Min.Microseconds(),
+		stats.Avg.Microseconds(),
+		stats.Max.Microseconds(),
+		stats.Jitter.Microseconds(),
+		timestamp.UTC(),
+	}}
+}
 
-	return execErr
+func flapIncidentOp(deviceID string, start, end time.Time, transitions int) writeOp {
+	return writeOp{"insertFlapIncident", []any{deviceID, start.UTC(), end.UTC(), transitions}}
 }
 
-func (d *DatabaseStorage) LogStatusChange(deviceID string, from, to monitor.ConnectionStatus, timestamp time.Time) error {
-	_, err := d.stmts["insertStatusChange"].Exec(
+func latencyAnomalyOp(deviceID string, anomaly monitor.LatencyAnomaly) writeOp {
+	return writeOp{"insertLatencyAnomaly", []any{
 		deviceID,
-		from.String(),
-		to.String(),
-		timestamp,
-	)
+		anomaly.At.UTC(),
+		anomaly.Latency.Microseconds(),
+		anomaly.Expected.Microseconds(),
+		anomaly.P95.Microseconds(),
+		anomaly.ExpectedP95.Microseconds(),
+		anomaly.Score,
+	}}
+}
+
+func (d *DatabaseStorage) exec(op writeOp) error {
+	_, err := d.stmts[op.stmt].Exec(op.args...)
 	return err
 }
 
+func (d *DatabaseStorage) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	return d.exec(connectivityCheckOp(deviceID, success, responseTime, timestamp, err))
+}
+
+func (d *DatabaseStorage) LogStatusChange(deviceID string, from, to monitor.ConnectionStatus, timestamp time.Time) error {
+	return d.exec(statusChangeOp(deviceID, from, to, timestamp))
+}
+
 func (d *DatabaseStorage) LogOutageStart(deviceID string, timestamp time.Time) error {
-	_, err := d.stmts["insertOutageStart"].Exec(deviceID, timestamp)
-	return err
+	return d.exec(outageStartOp(deviceID, timestamp))
 }
 
 func (d *DatabaseStorage) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
-	durationMs := duration.Milliseconds()
-	_, err := d.stmts["updateOutageEnd"].Exec(timestamp, durationMs, deviceID)
+	return d.exec(outageEndOp(deviceID, duration, timestamp))
+}
+
+func (d *DatabaseStorage) LogProbeStats(deviceID string, target string, stats monitor.ProbeStats, timestamp time.Time) error {
+	return d.exec(probeStatsOp(deviceID, target, stats, timestamp))
+}
+
+func (d *DatabaseStorage) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	return d.exec(flapIncidentOp(deviceID, start, end, transitions))
+}
+
+func (d *DatabaseStorage) LogLatencyAnomaly(deviceID string, anomaly monitor.LatencyAnomaly) error {
+	return d.exec(latencyAnomalyOp(deviceID, anomaly))
+}
+
+func (d *DatabaseStorage) RegisterDevice(device monitor.DeviceInfo) error {
+	labels, err := json.Marshal(device.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to encode labels: %w", err)
+	}
+
+	// no name stays NULL, readers fall back to DisplayName
+	name := sql.NullString{String: device.Name, Valid: device.Name != ""}
+	now := time.Now().UTC()
+	_, err = d.stmts["upsertDevice"].Exec(device.ID, name, device.Location, string(labels), now, now)
 	return err
 }
 
-func (d *DatabaseStorage) GetDowntimes(timespan time.Time) ([]DowntimeEvent, error) {
-	timeDifference := int(time.Since(timespan).Seconds())
+func (d *DatabaseStorage) GetDevices() ([]monitor.DeviceInfo, error) {
+	rows, err := d.stmts["selectDevices"].Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []monitor.DeviceInfo{}
+	for rows.Next() {
+		var device monitor.DeviceInfo
+		var name, location, labels sql.NullString
+		if err := rows.Scan(&device.ID, &name, &location, &labels); err != nil {
+			return nil, err
+		}
+		device.Name = name.String
+		device.Location = location.String
+		if labels.Valid && labels.String != "" {
+			if err := json.Unmarshal([]byte(labels.String), &device.Labels); err != nil {
+				return nil, fmt.Errorf("failed to decode labels of %s: %w", device.ID, err)
+			}
+		}
+		result = append(result, device)
+	}
+
+	return result, rows.Err()
+}
+
+func (d *DatabaseStorage) GetOpenOutage(deviceID string) (time.Time, bool, error) {
+	var start time.Time
+	err := d.stmts["selectOpenOutage"].QueryRow(deviceID).Scan(&start)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return start, true, nil
+}
+
+func (d *DatabaseStorage) GetLastCheck(deviceID string) (time.Time, bool, error) {
+	var last time.Time
+	err := d.stmts["selectLastCheck"].QueryRow(deviceID).Scan(&last)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return last, true, nil
+}
+
+func (d *DatabaseStorage) MarkOutageInterrupted(deviceID string) error {
+	_, err := d.stmts["markOutageInterrupted"].Exec(deviceID)
+	return err
+}
 
-	rows, err := d.db.Query(`SELECT * FROM outages WHERE start_time >= ?`, timeDifference)
+func (d *DatabaseStorage) GetChecks(deviceID string, from, to time.Time) ([]monitor.CheckRecord, error) {
+	rows, err := d.stmts["selectChecks"].Query(deviceID, deviceID, from.UTC(), to.UTC())
 	if err != nil {
 		return nil, err
 	}
+	return scanChecks(rows)
+}
 
-	result := []DowntimeEvent{}
+// scanChecks reads rows of device_id, success, response_time, timestamp, error.
+func scanChecks(rows *sql.Rows) ([]monitor.CheckRecord, error) {
+	defer rows.Close()
 
+	result := []monitor.CheckRecord{}
 	for rows.Next() {
-		var event DowntimeEvent
-		err := rows.Scan(&event.ID, &event.DeviceID, &event.StartTime, &event.EndTime, &event.Duration)
+		var check monitor.CheckRecord
+		var responseTimeMs sql.NullInt64
+		var errStr sql.NullString
+		if err := rows.Scan(&check.DeviceID, &check.Success, &responseTimeMs, &check.Timestamp, &errStr); err != nil {
+			return nil, err
+		}
+		check.ResponseTime = time.Duration(responseTimeMs.Int64) * time.Millisecond
+		check.Error = errStr.String
+		result = append(result, check)
+	}
 
-		if err != nil {
+	return result, rows.Err()
+}
+
+func (d *DatabaseStorage) GetStatusChanges(deviceID string, from, to time.Time) ([]monitor.StatusChangeRecord, error) {
+	rows, err := d.stmts["selectStatusChanges"].Query(deviceID, deviceID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []monitor.StatusChangeRecord{}
+	for rows.Next() {
+		var change monitor.StatusChangeRecord
+		var fromStatus, toStatus string
+		if err := rows.Scan(&change.DeviceID, &fromStatus, &toStatus, &change.Timestamp); err != nil {
+			return nil, err
+		}
+		change.From, _ = monitor.ParseConnectionStatus(fromStatus)
+		change.To, _ = monitor.ParseConnectionStatus(toStatus)
+		result = append(result, change)
+	}
+
+	return result, rows.Err()
+}
+
+func (d *DatabaseStorage) GetOutages(query monitor.OutageQuery) ([]monitor.OutageRecord, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if len(query.DeviceIDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(query.DeviceIDs)), ", ")
+		conditions = append(conditions, "device_id IN ("+placeholders+")")
+		for _, deviceID := range query.DeviceIDs {
+			args = append(args, deviceID)
+		}
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "start_time < ?")
+		args = append(args, query.To.UTC())
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "(end_time IS NULL OR end_time > ?)")
+		args = append(args, query.From.UTC())
+	}
+
+	switch query.State {
+	case monitor.OutagesOpen:
+		conditions = append(conditions, "end_time IS NULL")
+	case monitor.OutagesClosed:
+		conditions = append(conditions, "end_time IS NOT NULL")
+	}
+
+	if query.MinDuration > 0 {
+		// open outages have no duration yet, they count up to now
+		conditions = append(conditions, "((end_time IS NOT NULL AND duration >= ?) OR (end_time IS NULL AND start_time <= ?))")
+		args = append(args, query.MinDuration.Milliseconds(), time.Now().Add(-query.MinDuration).UTC())
+	}
+
+	sqlQuery := `SELECT id, device_id, start_time, end_time, duration, interrupted FROM outages`
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if query.Descending {
+		sqlQuery += " ORDER BY start_time DESC, id DESC"
+	} else {
+		sqlQuery += " ORDER BY start_time, id"
+	}
+	if query.Limit > 0 || query.Offset > 0 {
+		limit := query.Limit
+		if limit <= 0 {
+			limit = -1 // no limit in sqlite
+		}
+		sqlQuery += " LIMIT ? OFFSET ?"
+		args = append(args, limit, query.Offset)
+	}
+
+	rows, err := d.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outages: %w", err)
+	}
+	defer rows.Close()
+
+	result := []monitor.OutageRecord{}
+	for rows.Next() {
+		var outage monitor.OutageRecord
+		var endTime sql.NullTime
+		var durationMs sql.NullInt64
+		if err := rows.Scan(&outage.ID, &outage.DeviceID, &outage.Start, &endTime, &durationMs, &outage.Interrupted); err != nil {
 			return nil, err
 		}
+		if endTime.Valid {
+			outage.End = endTime.Time
+		}
+		outage.Duration = time.Duration(durationMs.Int64) * time.Millisecond
+		result = append(result, outage)
+	}
+
+	return result, rows.Err()
+}
+
+func (d *DatabaseStorage) GetDeviceStats(deviceID string, from, to time.Time) (monitor.DeviceStats, error) {
+	checks, err := d.GetChecks(deviceID, from, to)
+	if err != nil {
+		return monitor.DeviceStats{}, fmt.Errorf("failed to fetch checks: %w", err)
+	}
+	query := monitor.OutageQuery{From: from, To: to}
+	if deviceID != "" {
+		query.DeviceIDs = []string{deviceID}
+	}
+	outages, err := d.GetOutages(query)
+	if err != nil {
+		return monitor.DeviceStats{}, fmt.Errorf("failed to fetch outages: %w", err)
+	}
+	rollups, err := d.rollupsForStats(deviceID, from, to)
+	if err != nil {
+		return monitor.DeviceStats{}, fmt.Errorf("failed to fetch rollups: %w", err)
+	}
+
+	stats := monitor.ComputeDeviceStats(deviceID, from, to, checks, outages)
+	stats.AddRollups(rollups)
+	return stats, nil
+}
+
+// rollupsForStats returns the downsampled checks of a range, minute buckets
+// where they are still kept and hour buckets for the rest. Raw checks are
+// only deleted once rolled up, so these never overlap them.
+func (d *DatabaseStorage) rollupsForStats(deviceID string, from, to time.Time) ([]monitor.RollupRecord, error) {
+	minutes, err := d.GetRollups(deviceID, monitor.ResolutionMinute, from, to)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := d.GetRollups(deviceID, monitor.ResolutionHour, from, to)
+	if err != nil {
+		return nil, err
+	}
 
-		result = append(result, event)
+	type key struct {
+		deviceID string
+		hour     time.Time
+	}
+	covered := make(map[key]bool)
+	for _, rollup := range minutes {
+		covered[key{rollup.DeviceID, rollup.Bucket.Truncate(time.Hour)}] = true
 	}
 
+	result := minutes
+	for _, rollup := range hours {
+		if !covered[key{rollup.DeviceID, rollup.Bucket}] {
+			result = append(result, rollup)
+		}
+	}
 	return result, nil
 }
 
@@ -1,31 +1,252 @@
 package db
 
 import (
+	"WifiTracker/internals/monitor"
 	"WifiTracker/util"
-	"os"
+	"errors"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
-func TestDowntimeSpan(t *testing.T) {
-	tempFile, err := os.CreateTemp("", "tempdatabase-*.db")
-	if err != nil {
-		t.Fatalf("Error creating temp file: %v", err)
-	}
-
-	defer os.Remove(tempFile.Name()) // clean up
+// newTestStorage opens a fresh database that is closed and removed with the
+// test, WAL leaves -wal and -shm files next to it.
+func newTestStorage(t *testing.T) *DatabaseStorage {
+	return openTestStorage(t, filepath.Join(t.TempDir(), "test.db"))
+}
 
-	dbStorage, err := NewDatabaseStorage(tempFile.Name())
+func openTestStorage(t *testing.T, path string) *DatabaseStorage {
+	t.Helper()
+	dbStorage, err := NewDatabaseStorage(path)
 	if err != nil {
 		t.Fatalf("Error creating database: %v", err)
 	}
+	t.Cleanup(func() { dbStorage.Close() })
+	return dbStorage
+}
+
+func TestDowntimeSpan(t *testing.T) {
+	dbStorage := newTestStorage(t)
 
 	dbStorage.LogOutageStart("bbed78db-4aa8-46bc-930e-e689aabf5eb0", time.Now())
 	dbStorage.LogOutageEnd("bbed78db-4aa8-46bc-930e-e689aabf5eb0", time.Minute, time.Now())
 
-	_, err = dbStorage.GetDowntimes(util.OneDayAgo())
+	outages, err := dbStorage.GetOutages(monitor.OutageQuery{From: util.OneDayAgo()})
 	if err != nil {
 		t.Fatalf("Error fetching dowtimes: %v", err)
 	}
+	if len(outages) != 1 {
+		t.Errorf("Expected 1 outage in the last day, got: %d", len(outages))
+	}
+}
+
+func TestOpenOutageRecovery(t *testing.T) {
+	dbStorage := newTestStorage(t)
+
+	deviceID := "bbed78db-4aa8-46bc-930e-e689aabf5eb0"
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	lastCheck := start.Add(10 * time.Minute)
+
+	if _, open, err := dbStorage.GetOpenOutage(deviceID); err != nil || open {
+		t.Fatalf("Expected no open outage, got open=%v err=%v", open, err)
+	}
+
+	dbStorage.LogOutageStart(deviceID, start)
+	dbStorage.LogConnectivityCheck(deviceID, false, time.Second, lastCheck, nil)
+
+	openStart, open, err := dbStorage.GetOpenOutage(deviceID)
+	if err != nil || !open {
+		t.Fatalf("Expected open outage, got open=%v err=%v", open, err)
+	}
+	if !openStart.Equal(start) {
+		t.Errorf("Expected outage start %v, got: %v", start, openStart)
+	}
 
+	last, found, err := dbStorage.GetLastCheck(deviceID)
+	if err != nil || !found || !last.Equal(lastCheck) {
+		t.Errorf("Expected last check %v, got: %v (found=%v err=%v)", lastCheck, last, found, err)
+	}
+
+	if err := dbStorage.MarkOutageInterrupted(deviceID); err != nil {
+		t.Fatalf("Error marking outage interrupted: %v", err)
+	}
+	dbStorage.LogOutageEnd(deviceID, lastCheck.Sub(start), lastCheck)
+
+	outages, err := dbStorage.GetOutages(monitor.OutageQuery{DeviceIDs: []string{deviceID}, From: util.OneDayAgo()})
+	if err != nil {
+		t.Fatalf("Error fetching downtimes: %v", err)
+	}
+	if len(outages) != 1 || !outages[0].Interrupted {
+		t.Errorf("Expected outage to be flagged as interrupted, got: %+v", outages)
+	}
+}
+
+func TestDeviceRegistry(t *testing.T) {
+	dbStorage := newTestStorage(t)
+
+	device := monitor.DeviceInfo{
+		ID:       "bbed78db-4aa8-46bc-930e-e689aabf5eb0",
+		Name:     "office",
+		Location: "2nd floor",
+		Labels:   map[string]string{"isp": "fiber"},
+	}
+	if err := dbStorage.RegisterDevice(device); err != nil {
+		t.Fatalf("Error registering device: %v", err)
+	}
+
+	// registering again updates in place
+	device.Name = "office-router"
+	if err := dbStorage.RegisterDevice(device); err != nil {
+		t.Fatalf("Error re-registering device: %v", err)
+	}
+
+	devices, err := dbStorage.GetDevices()
+	if err != nil {
+		t.Fatalf("Error fetching devices: %v", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("Expected 1 device, got: %d", len(devices))
+	}
+	if devices[0].Name != "office-router" || devices[0].Location != "2nd floor" || devices[0].Labels["isp"] != "fiber" {
+		t.Errorf("Unexpected device: %+v", devices[0])
+	}
+
+	// an unnamed device stays unnamed instead of taking its ID as name
+	unnamed := monitor.DeviceInfo{ID: "0c7c1a52-0f7e-4d43-9d1c-2b8a5e1c6f3d"}
+	if err := dbStorage.RegisterDevice(unnamed); err != nil {
+		t.Fatalf("Error registering unnamed device: %v", err)
+	}
+	devices, err = dbStorage.GetDevices()
+	if err != nil {
+		t.Fatalf("Error fetching devices: %v", err)
+	}
+	if len(devices) != 2 || devices[0].ID != unnamed.ID {
+		t.Fatalf("Expected the unnamed device sorted by its ID, got: %+v", devices)
+	}
+	if devices[0].Name != "" || devices[0].DisplayName() != unnamed.ID {
+		t.Errorf("Expected an empty name that displays as the ID, got: %+v", devices[0])
+	}
+}
+
+func TestStorageQueries(t *testing.T) {
+	dbStorage := newTestStorage(t)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dbStorage.LogConnectivityCheck("a", true, 20*time.Millisecond, base, nil)
+	dbStorage.LogConnectivityCheck("a", false, time.Second, base.Add(time.Minute), errors.New("timeout"))
+	dbStorage.LogConnectivityCheck("b", true, time.Millisecond, base, nil)
+	dbStorage.LogStatusChange("a", monitor.Running, monitor.Down, base.Add(time.Minute))
+	dbStorage.LogOutageStart("a", base.Add(time.Minute))
+	dbStorage.LogOutageEnd("a", 5*time.Minute, base.Add(6*time.Minute))
+
+	from, to := base, base.Add(time.Hour)
+
+	checks, err := dbStorage.GetChecks("a", from, to)
+	if err != nil || len(checks) != 2 {
+		t.Fatalf("Expected 2 checks, got %d (err=%v)", len(checks), err)
+	}
+	if checks[1].Success || checks[1].Error != "timeout" {
+		t.Errorf("Unexpected failed check: %+v", checks[1])
+	}
+
+	changes, err := dbStorage.GetStatusChanges("", from, to)
+	if err != nil || len(changes) != 1 || changes[0].From != monitor.Running || changes[0].To != monitor.Down {
+		t.Errorf("Unexpected status changes: %+v (err=%v)", changes, err)
+	}
+
+	stats, err := dbStorage.GetDeviceStats("a", from, to)
+	if err != nil {
+		t.Fatalf("Error fetching stats: %v", err)
+	}
+	if stats.Checks != 2 || stats.FailedChecks != 1 || stats.Outages != 1 || stats.TotalDowntime != 5*time.Minute {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestOutageQuery(t *testing.T) {
+	dbStorage := newTestStorage(t)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	logOutage := func(deviceID string, start, end time.Time) {
+		dbStorage.LogOutageStart(deviceID, start)
+		if !end.IsZero() {
+			dbStorage.LogOutageEnd(deviceID, end.Sub(start), end)
+		}
+	}
+
+	// ends exactly at the window start, so it does not overlap
+	logOutage("a", from.Add(-time.Hour), from)
+	// spans the window start
+	logOutage("a", from.Add(-time.Hour), from.Add(time.Hour))
+	// inside the window, short
+	logOutage("a", from.Add(2*time.Hour), from.Add(2*time.Hour+time.Minute))
+	// spans the window end
+	logOutage("b", to.Add(-time.Hour), to.Add(time.Hour))
+	// starts exactly at the window end, so it does not overlap
+	logOutage("b", to, to.Add(time.Hour))
+	// still open, started inside the window
+	logOutage("c", from.Add(3*time.Hour), time.Time{})
+
+	starts := func(outages []monitor.OutageRecord) []time.Time {
+		result := []time.Time{}
+		for _, outage := range outages {
+			result = append(result, outage.Start)
+		}
+		return result
+	}
+
+	cases := map[string]struct {
+		query monitor.OutageQuery
+		want  []time.Time
+	}{
+		"window edges": {
+			query: monitor.OutageQuery{From: from, To: to},
+			want:  []time.Time{from.Add(-time.Hour), from.Add(2 * time.Hour), from.Add(3 * time.Hour), to.Add(-time.Hour)},
+		},
+		"devices": {
+			query: monitor.OutageQuery{DeviceIDs: []string{"b", "c"}, From: from, To: to},
+			want:  []time.Time{from.Add(3 * time.Hour), to.Add(-time.Hour)},
+		},
+		"min duration": {
+			query: monitor.OutageQuery{From: from, To: to, MinDuration: 30 * time.Minute},
+			want:  []time.Time{from.Add(-time.Hour), from.Add(3 * time.Hour), to.Add(-time.Hour)},
+		},
+		"open": {
+			query: monitor.OutageQuery{State: monitor.OutagesOpen},
+			want:  []time.Time{from.Add(3 * time.Hour)},
+		},
+		"closed newest first": {
+			query: monitor.OutageQuery{From: from, To: to, State: monitor.OutagesClosed, Descending: true},
+			want:  []time.Time{to.Add(-time.Hour), from.Add(2 * time.Hour), from.Add(-time.Hour)},
+		},
+		"pagination": {
+			query: monitor.OutageQuery{From: from, To: to, Limit: 2, Offset: 1},
+			want:  []time.Time{from.Add(2 * time.Hour), from.Add(3 * time.Hour)},
+		},
+		"offset only": {
+			query: monitor.OutageQuery{Offset: 5},
+			want:  []time.Time{to},
+		},
+	}
+
+	for name, c := range cases {
+		outages, err := dbStorage.GetOutages(c.query)
+		if err != nil {
+			t.Fatalf("%s: error fetching outages: %v", name, err)
+		}
+
+		got := starts(outages)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: expected %v, got %v", name, c.want, got)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(c.want[i]) {
+				t.Errorf("%s: expected %v, got %v", name, c.want, got)
+				break
+			}
+		}
+	}
 }
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"WifiTracker/internals/monitor"
+)
+
+// importChunk is how many lines are imported per transaction.
+const importChunk = 5000
+
+type ImportOptions struct {
+	// DeviceID replaces the device of every line. Older builds picked a new
+	// ID on every start, this folds their history into one device.
+	DeviceID string
+}
+
+// ImportReport summarises an import. Lines counts every non empty line.
+type ImportReport struct {
+	Lines       int
+	Imported    int
+	Duplicates  int
+	Unparseable []UnparseableLine
+}
+
+type UnparseableLine struct {
+	Number int
+	Text   string
+	Err    error
+}
+
+// dedupQueries find an event already in the database. The text log only
+// keeps whole seconds, so anything of the same kind within the second of
+// the event counts as the same event. Only rows from before the import are
+// looked at, a log that checked twice in one second keeps both checks.
+var dedupQueries = map[string]string{
+	monitor.EventConnectivityCheck: `SELECT 1 FROM connectivity_checks WHERE device_id = ? AND success = ? AND timestamp >= ? AND timestamp < ? AND id <= ? LIMIT 1`,
+	monitor.EventStatusChange:      `SELECT 1 FROM status_changes WHERE device_id = ? AND from_status = ? AND to_status = ? AND timestamp >= ? AND timestamp < ? AND id <= ? LIMIT 1`,
+	monitor.EventOutageStart:       `SELECT 1 FROM outages WHERE device_id = ? AND start_time >= ? AND start_time < ? AND id <= ? LIMIT 1`,
+	monitor.EventOutageEnd:         `SELECT 1 FROM outages WHERE device_id = ? AND end_time >= ? AND end_time < ? AND id <= ? LIMIT 1`,
+	monitor.EventProbeStats:        `SELECT 1 FROM probe_stats WHERE device_id = ? AND target = ? AND timestamp >= ? AND timestamp < ? AND id <= ? LIMIT 1`,
+	monitor.EventFlapIncident:      `SELECT 1 FROM flap_incidents WHERE device_id = ? AND end_time >= ? AND end_time < ? AND id <= ? LIMIT 1`,
+	monitor.EventLatencyAnomaly:    `SELECT 1 FROM latency_anomalies WHERE device_id = ? AND timestamp >= ? AND timestamp < ? AND id <= ? LIMIT 1`,
+	// checks that retention already rolled up, the import never adds any
+	"rollup": `SELECT 1 FROM check_rollups WHERE device_id = ? AND ((resolution = 'minute' AND bucket = ?) OR (resolution = 'hour' AND bucket = ?)) LIMIT 1`,
+}
+
+// dedupTables are the tables behind dedupQueries, their last id before the
+// import bounds the lookups.
+var dedupTables = map[string]string{
+	monitor.EventConnectivityCheck: "connectivity_checks",
+	monitor.EventStatusChange:      "status_changes",
+	monitor.EventOutageStart:       "outages",
+	monitor.EventOutageEnd:         "outages",
+	monitor.EventProbeStats:        "probe_stats",
+	monitor.EventFlapIncident:      "flap_incidents",
+	monitor.EventLatencyAnomaly:    "latency_anomalies",
+}
+
+// ImportLog replays a log written by the WifiLogger, in either format, into
+// the database. Events already in the database are skipped, so importing
+// the same log twice or a log the monitor also wrote to sqlite is safe.
+// Lines that can't be parsed or replayed are reported, not fatal.
+func (d *DatabaseStorage) ImportLog(r io.Reader, options ImportOptions) (ImportReport, error) {
+	report := ImportReport{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	before := make(map[string]int64, len(dedupTables))
+	for event, table := range dedupTables {
+		var last int64
+		if err := d.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM ` + table).Scan(&last); err != nil {
+			return report, fmt.Errorf("failed to read the last id of %s: %w", table, err)
+		}
+		before[event] = last
+	}
+
+	importer, err := d.beginImport(before)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if importer != nil {
+			importer.tx.Rollback()
+		}
+	}()
+
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+		report.Lines++
+
+		event, err := monitor.ParseLogLine(line)
+		if err == nil && options.DeviceID != "" {
+			event.Device = options.DeviceID
+		}
+		if err == nil {
+			var duplicate bool
+			duplicate, err = importer.exists(event)
+			if err == nil && duplicate {
+				report.Duplicates++
+				continue
+			}
+			if err == nil {
+				err = event.Replay(importer)
+			}
+		}
+		if err != nil {
+			report.Unparseable = append(report.Unparseable, UnparseableLine{Number: number, Text: line, Err: err})
+			continue
+		}
+		report.Imported++
+
+		if report.Imported%importChunk == 0 {
+			if err := importer.tx.Commit(); err != nil {
+				return report, fmt.Errorf("failed to commit import at line %d: %w", number, err)
+			}
+			if importer, err = d.beginImport(before); err != nil {
+				return report, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("failed to read log at line %d: %w", number+1, err)
+	}
+
+	if err := importer.tx.Commit(); err != nil {
+		return report, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return report, nil
+}
+
+// logImporter writes events inside an import transaction. It implements
+// monitor.StorageWriter so events can replay themselves into it.
+type logImporter struct {
+	d     *DatabaseStorage
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+	dedup map[string]*sql.Stmt
+	// before is the last id per event type when the import began
+	before map[string]int64
+}
+
+func (d *DatabaseStorage) beginImport(before map[string]int64) (*logImporter, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import: %w", err)
+	}
+
+	importer := &logImporter{d: d, tx: tx, stmts: make(map[string]*sql.Stmt), dedup: make(map[string]*sql.Stmt), before: before}
+	for name, query := range dedupQueries {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to prepare %s lookup: %w", name, err)
+		}
+		importer.dedup[name] = stmt
+	}
+	return importer, nil
+}
+
+func (i *logImporter) exists(event monitor.LogEvent) (bool, error) {
+	from := event.Timestamp.UTC().Truncate(time.Second)
+	to := from.Add(time.Second)
+
+	var args []any
+	switch event.Type {
+	case monitor.EventConnectivityCheck:
+		args = []any{event.Device, *event.Success, from, to}
+	case monitor.EventStatusChange:
+		args = []any{event.Device, event.From, event.To, from, to}
+	case monitor.EventProbeStats:
+		args = []any{event.Device, event.Target, from, to}
+	default:
+		args = []any{event.Device, from, to}
+	}
+
+	found, err := i.query(event.Type, append(args, i.before[event.Type])...)
+	if err != nil || found || event.Type != monitor.EventConnectivityCheck {
+		return found, err
+	}
+	return i.query("rollup", event.Device, from.Truncate(time.Minute), from.Truncate(time.Hour))
+}
+
+func (i *logImporter) query(name string, args ...any) (bool, error) {
+	var one int
+	err := i.dedup[name].QueryRow(args...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+	return true, nil
+}
+
+func (i *logImporter) exec(op writeOp) error {
+	stmt, ok := i.stmts[op.stmt]
+	if !ok {
+		stmt = i.tx.Stmt(i.d.stmts[op.stmt])
+		i.stmts[op.stmt] = stmt
+	}
+	_, err := stmt.Exec(op.args...)
+	return err
+}
+
+func (i *logImporter) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	return i.exec(connectivityCheckOp(deviceID, success, responseTime, timestamp, err))
+}
+
+func (i *logImporter) LogStatusChange(deviceID string, from, to monitor.ConnectionStatus, timestamp time.Time) error {
+	return i.exec(statusChangeOp(deviceID, from, to, timestamp))
+}
+
+func (i *logImporter) LogOutageStart(deviceID string, timestamp time.Time) error {
+	return i.exec(outageStartOp(deviceID, timestamp))
+}
+
+func (i *logImporter) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
+	return i.exec(outageEndOp(deviceID, duration, timestamp))
+}
+
+func (i *logImporter) LogProbeStats(deviceID string, target string, stats monitor.ProbeStats, timestamp time.Time) error {
+	return i.exec(probeStatsOp(deviceID, target, stats, timestamp))
+}
+
+func (i *logImporter) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	return i.exec(flapIncidentOp(deviceID, start, end, transitions))
+}
+
+func (i *logImporter) LogLatencyAnomaly(deviceID string, anomaly monitor.LatencyAnomaly) error {
+	return i.exec(latencyAnomalyOp(deviceID, anomaly))
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"WifiTracker/internals/monitor"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportLog(t *testing.T) {
+	dbStorage := newTestStorage(t)
+
+	logText := `[2024-03-01T10:00:00+01:00] DEVICE: run-1 CONNECTED IN 0.12 SECONDS
+[2024-03-01T10:00:01+01:00] DEVICE: run-1 FAILED TO CONNECT IN 2.00 SECONDS, ERROR: i/o timeout
+[2024-03-01T10:00:03+01:00] DEVICE: run-1 STATUS CHANGE: RUNNING -> DOWN
+[2024-03-01T10:00:03+01:00] DEVICE: run-1 OUTAGE START
+garbage in the middle
+
+[2024-03-01T10:00:33+01:00] DEVICE: run-1 OUTAGE END: LASTED 30 SECONDS
+[2024-03-01T10:00:33+01:00] DEVICE: run-1 STATUS CHANGE: DOWN -> SIDEWAYS
+[2024-03-01T11:00:00+01:00] DEVICE: run-1 LATENCY ANOMALY: AVG 250.00 MS EXPECTED 40.00 MS P95 300.00 MS EXPECTED 60.00 MS SCORE 12.50
+`
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	t.Run("FirstImport", func(t *testing.T) {
+		report, err := dbStorage.ImportLog(strings.NewReader(logText), ImportOptions{DeviceID: "device"})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if report.Lines != 8 || report.Imported != 6 || report.Duplicates != 0 {
+			t.Errorf("Expected 8 lines with 6 imported, got %+v", report)
+		}
+		if len(report.Unparseable) != 2 || report.Unparseable[0].Number != 5 || report.Unparseable[1].Number != 8 {
+			t.Errorf("Expected lines 5 and 8 to be reported, got %+v", report.Unparseable)
+		}
+
+		checks, _ := dbStorage.GetChecks("device", from, to)
+		if len(checks) != 2 || checks[1].Error != "i/o timeout" || checks[0].ResponseTime != 120*time.Millisecond {
+			t.Errorf("Expected both checks under the given device, got %+v", checks)
+		}
+
+		outages, _ := dbStorage.GetOutages(monitor.OutageQuery{DeviceIDs: []string{"device"}})
+		if len(outages) != 1 || outages[0].Open() || outages[0].Duration != 30*time.Second {
+			t.Fatalf("Expected one closed outage of 30s, got %+v", outages)
+		}
+		if want := time.Date(2024, 3, 1, 9, 0, 3, 0, time.UTC); !outages[0].Start.Equal(want) {
+			t.Errorf("Expected the outage to start at %v, got %v", want, outages[0].Start)
+		}
+
+		var latency, expected int64
+		if err := dbStorage.db.QueryRow(`SELECT latency, expected FROM latency_anomalies WHERE device_id = 'device'`).Scan(&latency, &expected); err != nil {
+			t.Fatalf("Failed to read the anomaly: %v", err)
+		}
+		if latency != 250000 || expected != 40000 {
+			t.Errorf("Expected an anomaly of 250ms over 40ms, got %dus over %dus", latency, expected)
+		}
+	})
+
+	t.Run("SecondImportIsDeduplicated", func(t *testing.T) {
+		report, err := dbStorage.ImportLog(strings.NewReader(logText), ImportOptions{DeviceID: "device"})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if report.Imported != 0 || report.Duplicates != 6 {
+			t.Errorf("Expected every event to be a duplicate, got %+v", report)
+		}
+
+		changes, _ := dbStorage.GetStatusChanges("device", from, to)
+		if len(changes) != 1 {
+			t.Errorf("Expected 1 status change, got %d", len(changes))
+		}
+	})
+
+	t.Run("MatchesMonitorWrites", func(t *testing.T) {
+		// the monitor wrote the same check with full precision
+		dbStorage.LogConnectivityCheck("live", true, 123*time.Millisecond, time.Date(2024, 3, 2, 10, 0, 0, 456000000, time.UTC), nil)
+
+		report, err := dbStorage.ImportLog(strings.NewReader("[2024-03-02T10:00:00Z] DEVICE: live CONNECTED IN 0.12 SECONDS\n"), ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if report.Duplicates != 1 {
+			t.Errorf("Expected the logged check to match the stored one, got %+v", report)
+		}
+	})
+
+	t.Run("KeepsChecksWithinASecond", func(t *testing.T) {
+		twice := `[2024-03-03T10:00:00Z] DEVICE: busy CONNECTED IN 0.12 SECONDS
+[2024-03-03T10:00:00Z] DEVICE: busy CONNECTED IN 0.30 SECONDS
+`
+		report, err := dbStorage.ImportLog(strings.NewReader(twice), ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if report.Imported != 2 || report.Duplicates != 0 {
+			t.Errorf("Expected both checks of the log to be imported, got %+v", report)
+		}
+
+		report, _ = dbStorage.ImportLog(strings.NewReader(twice), ImportOptions{})
+		if report.Imported != 0 || report.Duplicates != 2 {
+			t.Errorf("Expected both checks to be duplicates the second time, got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// build than this one, writing to it could corrupt data that build relies on.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// migration moves the schema one version forward. Migrations are applied in
+// order, each in its own transaction, and never edited once released: to
+// change the schema append a new one.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+	// apply runs after the statements, for changes plain SQL can't express
+	apply func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{
+		// IF NOT EXISTS adopts databases created before versioning
+		version: 1,
+		name:    "initial schema",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS connectivity_checks (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				device_id TEXT NOT NULL,
+				success BOOLEAN NOT NULL,
+				response_time INTEGER, -- milliseconds
+				timestamp DATETIME NOT NULL,
+				error TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS status_changes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				device_id TEXT NOT NULL,
+				from_status TEXT NOT NULL,
+				to_status TEXT NOT NULL,
+				timestamp DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS outages (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				device_id TEXT NOT NULL,
+				start_time DATETIME NOT NULL,
+				end_time DATETIME,
+				duration INTEGER -- milliseconds
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_connectivity_device_time ON connectivity_checks(device_id, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_status_device_time ON status_changes(device_id, timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_outages_device_time ON outages(device_id, start_time)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "outage interrupted flag",
+		apply: func(tx *sql.Tx) error {
+			return addColumnIfMissing(tx, "outages", "interrupted", "BOOLEAN NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		version: 3,
+		name:    "probe stats, flap incidents and devices",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS probe_stats (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				device_id TEXT NOT NULL,
+				target TEXT NOT NULL,
+				sent INTEGER NOT NULL,
+				received INTEGER NOT NULL,
+				loss REAL NOT NULL, -- percent
+				min_rtt INTEGER, -- microseconds
+				avg_rtt INTEGER, -- microseconds
+				max_rtt INTEGER, -- microseconds
+				jitter INTEGER, -- microseconds
+				timestamp DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS flap_incidents (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				device_id TEXT NOT NULL,
+				start_time DATETIME NOT NULL,
+				end_time DATETIME NOT NULL,
+				transitions INTEGER NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS devices (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				location TEXT,
+				labels TEXT, -- json object
+				first_seen DATETIME NOT NULL,
+				last_seen DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_probe_stats_device_time ON probe_stats(device_id, timestamp)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "check rollups",
+		statements: []string{
+			`CREATE TABLE check_rollups (
+				device_id TEXT NOT NULL,
+				resolution TEXT NOT NULL, -- minute or hour
+				bucket DATETIME NOT NULL,
+				count INTEGER NOT NULL,
+				failures INTEGER NOT NULL,
+				min_latency INTEGER NOT NULL, -- milliseconds, successful checks only
+				avg_latency INTEGER NOT NULL,
+				max_latency INTEGER NOT NULL,
+				p95_latency INTEGER NOT NULL,
+				PRIMARY KEY (device_id, resolution, bucket)
+			)`,
+			`CREATE INDEX idx_check_rollups_resolution_bucket ON check_rollups(resolution, bucket)`,
+			// retention finds the oldest checks across devices
+			`CREATE INDEX idx_connectivity_time ON connectivity_checks(timestamp)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "latency anomalies",
+		statements: []string{
+			`CREATE TABLE latency_anomalies (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				device_id TEXT NOT NULL,
+				timestamp DATETIME NOT NULL,
+				latency INTEGER NOT NULL, -- microseconds
+				expected INTEGER NOT NULL,
+				p95 INTEGER NOT NULL,
+				expected_p95 INTEGER NOT NULL,
+				score REAL NOT NULL
+			)`,
+			`CREATE INDEX idx_latency_anomalies_device_time ON latency_anomalies(device_id, timestamp)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "nullable device names",
+		// sqlite can't drop a NOT NULL, so the table is copied. Unnamed
+		// devices used to get their ID as name.
+		statements: []string{
+			`CREATE TABLE devices_new (
+				id TEXT PRIMARY KEY,
+				name TEXT,
+				location TEXT,
+				labels TEXT, -- json object
+				first_seen DATETIME NOT NULL,
+				last_seen DATETIME NOT NULL
+			)`,
+			`INSERT INTO devices_new SELECT id, NULLIF(name, id), location, labels, first_seen, last_seen FROM devices`,
+			`DROP TABLE devices`,
+			`ALTER TABLE devices_new RENAME TO devices`,
+		},
+	},
+}
+
+// migrate brings the database up to the last of the given migrations.
+func migrate(db *sql.DB, migrations []migration) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if m.apply != nil {
+		if err := m.apply(tx); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, m.version, m.name, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addColumnIfMissing lets a migration run against databases that already
+// got the column from an unversioned build.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	openTemp := func(t *testing.T) (*sql.DB, string) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("Error opening database: %v", err)
+		}
+		return db, path
+	}
+	latest := migrations[len(migrations)-1].version
+
+	t.Run("FreshDatabase", func(t *testing.T) {
+		db, path := openTemp(t)
+		db.Close()
+
+		dbStorage := openTestStorage(t, path)
+
+		version, err := schemaVersion(dbStorage.db)
+		if err != nil {
+			t.Fatalf("Failed to read schema version: %v", err)
+		}
+		if version != latest {
+			t.Errorf("Expected schema version %d, got %d", latest, version)
+		}
+	})
+
+	t.Run("UnversionedDatabase", func(t *testing.T) {
+		db, path := openTemp(t)
+		// the schema before versioning, outages has no interrupted column
+		for _, statement := range migrations[0].statements {
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatalf("Failed to create old schema: %v", err)
+			}
+		}
+		if _, err := db.Exec(`INSERT INTO outages (device_id, start_time) VALUES ('old', '2024-01-01 00:00:00')`); err != nil {
+			t.Fatalf("Failed to insert old outage: %v", err)
+		}
+		db.Close()
+
+		dbStorage := openTestStorage(t, path)
+
+		if err := dbStorage.MarkOutageInterrupted("old"); err != nil {
+			t.Fatalf("Expected interrupted column after migration: %v", err)
+		}
+		var interrupted bool
+		if err := dbStorage.db.QueryRow(`SELECT interrupted FROM outages WHERE device_id = 'old'`).Scan(&interrupted); err != nil || !interrupted {
+			t.Errorf("Expected old outage to be marked interrupted, got %v (err %v)", interrupted, err)
+		}
+	})
+
+	t.Run("NewerDatabase", func(t *testing.T) {
+		db, path := openTemp(t)
+		if err := migrate(db, migrations); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'from the future', CURRENT_TIMESTAMP)`, latest+1); err != nil {
+			t.Fatalf("Failed to bump schema version: %v", err)
+		}
+		db.Close()
+
+		if _, err := NewDatabaseStorage(path); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+		}
+	})
+
+	t.Run("UnnamedDevices", func(t *testing.T) {
+		db, path := openTemp(t)
+		// before version 6 an unnamed device was stored with its ID as name
+		if err := migrate(db, migrations[:5]); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO devices (id, name, first_seen, last_seen) VALUES ('dev', 'dev', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), ('lab', 'lab printer', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			t.Fatalf("Failed to insert old devices: %v", err)
+		}
+		db.Close()
+
+		dbStorage := openTestStorage(t, path)
+
+		devices, err := dbStorage.GetDevices()
+		if err != nil {
+			t.Fatalf("Error fetching devices: %v", err)
+		}
+		if len(devices) != 2 || devices[0].Name != "" || devices[1].Name != "lab printer" {
+			t.Errorf("Expected only the ID-as-name to be cleared, got: %+v", devices)
+		}
+	})
+
+	t.Run("FailedMigrationRollsBack", func(t *testing.T) {
+		db, _ := openTemp(t)
+		defer db.Close()
+
+		broken := []migration{
+			migrations[0],
+			{version: 2, name: "broken", statements: []string{
+				`CREATE TABLE half_done (id INTEGER)`,
+				`NOT SQL`,
+			}},
+		}
+		if err := migrate(db, broken); err == nil {
+			t.Fatal("Expected broken migration to fail")
+		}
+
+		version, err := schemaVersion(db)
+		if err != nil {
+			t.Fatalf("Failed to read schema version: %v", err)
+		}
+		if version != 1 {
+			t.Errorf("Expected schema version 1 after failed migration, got %d", version)
+		}
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&count)
+		if count != 0 {
+			t.Error("Expected the failed migration to be rolled back")
+		}
+	})
+}
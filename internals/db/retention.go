@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"WifiTracker/internals/monitor"
+)
+
+var _ monitor.RollupReader = (*DatabaseStorage)(nil)
+
+// RetentionConfig decides how long each level of detail is kept. Raw checks
+// older than RawRetention are rolled up into minute and hour buckets and
+// deleted, the buckets are deleted in turn after their own retention. Probe
+// stats and latency anomalies are deleted along with the raw checks. A zero
+// retention keeps that level forever.
+type RetentionConfig struct {
+	RawRetention    time.Duration
+	MinuteRetention time.Duration
+	HourRetention   time.Duration
+	// Interval is how often the background job runs.
+	Interval time.Duration
+	OnError  func(error)
+}
+
+func DefaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{
+		RawRetention:    7 * 24 * time.Hour,
+		MinuteRetention: 90 * 24 * time.Hour,
+		Interval:        time.Hour,
+	}
+}
+
+// RunRetention applies the retention config right away and then every
+// interval until the context is cancelled.
+func (d *DatabaseStorage) RunRetention(ctx context.Context, config RetentionConfig) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultRetentionConfig().Interval
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Println("failed to apply retention:", err)
+		}
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.ApplyRetention(ctx, config, time.Now()); err != nil {
+			config.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyRetention rolls up and deletes everything that expired at now. Raw
+// checks are rolled up one hour at a time, each hour in its own transaction,
+// so a large backlog doesn't hold the write lock for long.
+func (d *DatabaseStorage) ApplyRetention(ctx context.Context, config RetentionConfig, now time.Time) error {
+	if config.RawRetention > 0 {
+		// only whole hours, so an hour bucket is never built from half its checks
+		cutoff := now.Add(-config.RawRetention).UTC().Truncate(time.Hour)
+		var previous time.Time
+		for ctx.Err() == nil {
+			var oldest time.Time
+			err := d.stmts["selectOldestCheck"].QueryRow(cutoff).Scan(&oldest)
+			if err == sql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to find oldest check: %w", err)
+			}
+
+			start := oldest.UTC().Truncate(time.Hour)
+			if start.Equal(previous) {
+				return fmt.Errorf("checks from %s were not rolled up", start.Format(time.RFC3339))
+			}
+			previous = start
+			if err := d.rollUpChecks(start, start.Add(time.Hour)); err != nil {
+				return fmt.Errorf("failed to roll up checks from %s: %w", start.Format(time.RFC3339), err)
+			}
+		}
+	}
+
+	// probe stats and anomalies have no rollups, they just go with the checks
+	if config.RawRetention > 0 {
+		cutoff := now.Add(-config.RawRetention).UTC()
+		for _, table := range []string{"probe_stats", "latency_anomalies"} {
+			if _, err := d.db.Exec(`DELETE FROM `+table+` WHERE timestamp < ?`, cutoff); err != nil {
+				return fmt.Errorf("failed to delete old %s: %w", table, err)
+			}
+		}
+	}
+
+	for resolution, retention := range map[monitor.Resolution]time.Duration{
+		monitor.ResolutionMinute: config.MinuteRetention,
+		monitor.ResolutionHour:   config.HourRetention,
+	} {
+		if retention <= 0 {
+			continue
+		}
+		if _, err := d.db.Exec(`DELETE FROM check_rollups WHERE resolution = ? AND bucket < ?`, resolution, now.Add(-retention).UTC()); err != nil {
+			return fmt.Errorf("failed to delete %s rollups: %w", resolution, err)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// rollUpChecks moves the raw checks in [start, end) into rollups. Buckets
+// that already exist, say from checks imported late, are merged. The merged
+// p95 is the larger of the two, the exact value can't be recovered.
+func (d *DatabaseStorage) rollUpChecks(start, end time.Time) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT device_id, success, response_time, timestamp, error FROM connectivity_checks WHERE timestamp >= ? AND timestamp < ?`, start.UTC(), end.UTC())
+	if err != nil {
+		return err
+	}
+	checks, err := scanChecks(rows)
+	if err != nil {
+		return err
+	}
+
+	upsert, err := tx.Prepare(`INSERT INTO check_rollups (device_id, resolution, bucket, count, failures, min_latency, avg_latency, max_latency, p95_latency)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(device_id, resolution, bucket) DO UPDATE SET
+			min_latency = CASE
+				WHEN count = failures THEN excluded.min_latency
+				WHEN excluded.count = excluded.failures THEN min_latency
+				ELSE MIN(min_latency, excluded.min_latency) END,
+			avg_latency = CASE
+				WHEN count - failures + excluded.count - excluded.failures = 0 THEN 0
+				ELSE (avg_latency * (count - failures) + excluded.avg_latency * (excluded.count - excluded.failures)) / (count - failures + excluded.count - excluded.failures) END,
+			max_latency = MAX(max_latency, excluded.max_latency),
+			p95_latency = MAX(p95_latency, excluded.p95_latency),
+			count = count + excluded.count,
+			failures = failures + excluded.failures`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+
+	for _, resolution := range []monitor.Resolution{monitor.ResolutionMinute, monitor.ResolutionHour} {
+		for _, rollup := range monitor.RollupChecks(checks, resolution) {
+			if _, err := upsert.Exec(
+				rollup.DeviceID,
+				rollup.Resolution,
+				rollup.Bucket,
+				rollup.Count,
+				rollup.Failures,
+				rollup.Min.Milliseconds(),
+				rollup.Avg.Milliseconds(),
+				rollup.Max.Milliseconds(),
+				rollup.P95.Milliseconds(),
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM connectivity_checks WHERE timestamp >= ? AND timestamp < ?`, start.UTC(), end.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DatabaseStorage) GetRollups(deviceID string, resolution monitor.Resolution, from, to time.Time) ([]monitor.RollupRecord, error) {
+	rows, err := d.stmts["selectRollups"].Query(deviceID, deviceID, resolution, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []monitor.RollupRecord{}
+	for rows.Next() {
+		var rollup monitor.RollupRecord
+		var minMs, avgMs, maxMs, p95Ms int64
+		if err := rows.Scan(&rollup.DeviceID, &rollup.Resolution, &rollup.Bucket, &rollup.Count, &rollup.Failures, &minMs, &avgMs, &maxMs, &p95Ms); err != nil {
+			return nil, err
+		}
+		rollup.Min = time.Duration(minMs) * time.Millisecond
+		rollup.Avg = time.Duration(avgMs) * time.Millisecond
+		rollup.Max = time.Duration(maxMs) * time.Millisecond
+		rollup.P95 = time.Duration(p95Ms) * time.Millisecond
+		result = append(result, rollup)
+	}
+
+	return result, rows.Err()
+}
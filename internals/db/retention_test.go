@@ -0,0 +1,133 @@
+package db
+
+import (
+	"WifiTracker/internals/monitor"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	dbStorage := newTestStorage(t)
+
+	deviceID := "bbed78db-4aa8-46bc-930e-e689aabf5eb0"
+	now := time.Date(2024, 3, 20, 12, 30, 0, 0, time.UTC)
+	old := time.Date(2024, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	// two hours of old checks, one per 30s, every tenth failing
+	for i := 0; i < 240; i++ {
+		success := i%10 != 0
+		dbStorage.LogConnectivityCheck(deviceID, success, time.Duration(10+i%5)*time.Millisecond, old.Add(time.Duration(i)*30*time.Second), nil)
+	}
+	dbStorage.LogConnectivityCheck(deviceID, true, 10*time.Millisecond, now.Add(-time.Hour), nil)
+
+	config := RetentionConfig{RawRetention: 7 * 24 * time.Hour, MinuteRetention: 10 * 24 * time.Hour}
+
+	t.Run("RollsUpOldChecks", func(t *testing.T) {
+		if err := dbStorage.ApplyRetention(context.Background(), config, now); err != nil {
+			t.Fatalf("Failed to apply retention: %v", err)
+		}
+
+		checks, err := dbStorage.GetChecks(deviceID, old, now)
+		if err != nil {
+			t.Fatalf("Failed to fetch checks: %v", err)
+		}
+		if len(checks) != 1 {
+			t.Errorf("Expected only the recent check to stay raw, got %d", len(checks))
+		}
+
+		hours, err := dbStorage.GetRollups(deviceID, monitor.ResolutionHour, old, now)
+		if err != nil {
+			t.Fatalf("Failed to fetch hour rollups: %v", err)
+		}
+		if len(hours) != 2 {
+			t.Fatalf("Expected 2 hour rollups, got %d", len(hours))
+		}
+		if hours[0].Count != 120 || hours[0].Failures != 12 {
+			t.Errorf("Expected 120 checks with 12 failures, got %d/%d", hours[0].Count, hours[0].Failures)
+		}
+		if hours[0].Min != 10*time.Millisecond || hours[0].Max != 14*time.Millisecond {
+			t.Errorf("Expected latency between 10ms and 14ms, got %v-%v", hours[0].Min, hours[0].Max)
+		}
+
+		minutes, err := dbStorage.GetRollups("", monitor.ResolutionMinute, old, now)
+		if err != nil {
+			t.Fatalf("Failed to fetch minute rollups: %v", err)
+		}
+		if len(minutes) != 120 {
+			t.Errorf("Expected 120 minute rollups, got %d", len(minutes))
+		}
+	})
+
+	t.Run("StatsIncludeRollups", func(t *testing.T) {
+		stats, err := dbStorage.GetDeviceStats(deviceID, old, now)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Checks != 241 || stats.FailedChecks != 24 {
+			t.Errorf("Expected rolled up and raw checks to count, got %d/%d", stats.Checks, stats.FailedChecks)
+		}
+	})
+
+	t.Run("MergesLateChecks", func(t *testing.T) {
+		dbStorage.LogConnectivityCheck(deviceID, true, 50*time.Millisecond, old.Add(time.Second), nil)
+		if err := dbStorage.ApplyRetention(context.Background(), config, now); err != nil {
+			t.Fatalf("Failed to apply retention: %v", err)
+		}
+
+		hours, _ := dbStorage.GetRollups(deviceID, monitor.ResolutionHour, old, old.Add(time.Hour))
+		if len(hours) != 1 || hours[0].Count != 121 || hours[0].Max != 50*time.Millisecond {
+			t.Errorf("Expected the late check merged into the hour, got %+v", hours)
+		}
+	})
+
+	t.Run("ExpiresRollups", func(t *testing.T) {
+		// the recent check is rolled up too, only its minute is young enough
+		later := now.Add(8 * 24 * time.Hour)
+		if err := dbStorage.ApplyRetention(context.Background(), config, later); err != nil {
+			t.Fatalf("Failed to apply retention: %v", err)
+		}
+
+		minutes, _ := dbStorage.GetRollups(deviceID, monitor.ResolutionMinute, old, later)
+		if len(minutes) != 1 {
+			t.Errorf("Expected only the minute of the recent check left, got %d", len(minutes))
+		}
+		hours, _ := dbStorage.GetRollups(deviceID, monitor.ResolutionHour, old, later)
+		if len(hours) != 3 {
+			t.Errorf("Expected hour rollups to be kept, got %d", len(hours))
+		}
+	})
+
+	t.Run("PrunesProbeStatsAndAnomalies", func(t *testing.T) {
+		stats := monitor.ProbeStats{Sent: 4, Received: 3, Loss: 25}
+		anomaly := monitor.LatencyAnomaly{Latency: 200 * time.Millisecond, Expected: 20 * time.Millisecond, Score: 5}
+		for _, at := range []time.Time{old, now.Add(-time.Hour)} {
+			dbStorage.LogProbeStats(deviceID, "8.8.8.8", stats, at)
+			anomaly.At = at
+			dbStorage.LogLatencyAnomaly(deviceID, anomaly)
+		}
+
+		if err := dbStorage.ApplyRetention(context.Background(), config, now); err != nil {
+			t.Fatalf("Failed to apply retention: %v", err)
+		}
+
+		for _, table := range []string{"probe_stats", "latency_anomalies"} {
+			var count int
+			if err := dbStorage.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil {
+				t.Fatalf("Failed to count %s: %v", table, err)
+			}
+			if count != 1 {
+				t.Errorf("Expected only the recent row of %s to be kept, got %d", table, count)
+			}
+		}
+	})
+
+	t.Run("StopsOnCancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := dbStorage.ApplyRetention(ctx, config, now); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// AnomalyConfig decides when latency is anomalous. The last minute of
+// latency is compared to what the same hour of the same weekday usually
+// looks like, both its average and its 95th percentile.
+type AnomalyConfig struct {
+	Disabled bool
+	// Deviations is how many standard deviations above the baseline the
+	// last minute has to be.
+	Deviations float64
+	// MinIncrease is the least the latency has to rise by, so a very steady
+	// connection is not flagged over a few milliseconds.
+	MinIncrease time.Duration
+	// MinSamples is how many minutes an hour of the week needs to have been
+	// seen before it is trusted.
+	MinSamples int
+	// History is how far back Config.History is read on start.
+	History time.Duration
+	// Location is the time zone of the hours of the week, local by default.
+	Location *time.Location
+}
+
+func DefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{
+		Deviations:  3,
+		MinIncrease: 20 * time.Millisecond,
+		MinSamples:  30,
+		History:     28 * 24 * time.Hour,
+		Location:    time.Local,
+	}
+}
+
+// LatencyAnomaly is a minute of latency well above the baseline.
+type LatencyAnomaly struct {
+	At time.Time
+	// Latency and P95 are over the last minute, Expected and ExpectedP95
+	// the baseline for this hour of the week.
+	Latency     time.Duration
+	Expected    time.Duration
+	P95         time.Duration
+	ExpectedP95 time.Duration
+	// Score is how far above the baseline the worse of the two is, in
+	// standard deviations.
+	Score float64
+}
+
+// running mean and variance, Welford's algorithm
+type welford struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (w *welford) add(x float64) {
+	w.n++
+	delta := x - w.mean
+	w.mean += delta / float64(w.n)
+	w.m2 += delta * (x - w.mean)
+}
+
+func (w welford) stddev() float64 {
+	if w.n < 2 {
+		return 0
+	}
+	return math.Sqrt(w.m2 / float64(w.n-1))
+}
+
+// exceeds reports whether value is anomalous for this distribution and by
+// how many standard deviations. Below a millisecond of spread the score
+// counts milliseconds, a perfectly steady baseline would score infinity.
+func (w welford) exceeds(value time.Duration, config AnomalyConfig) (float64, bool) {
+	stddev := w.stddev()
+	limit := w.mean + max(config.Deviations*stddev, float64(config.MinIncrease))
+	score := (float64(value) - w.mean) / max(stddev, float64(time.Millisecond))
+	return score, float64(value) > limit
+}
+
+type baselineSlot struct {
+	avg, p95 welford
+}
+
+// latencyBaseline is the normal per minute latency of a device for each
+// hour of the week. It is not safe for concurrent use, the monitor guards
+// it with its lock.
+type latencyBaseline struct {
+	slots    [7 * 24]baselineSlot
+	location *time.Location
+}
+
+func newLatencyBaseline(location *time.Location) *latencyBaseline {
+	if location == nil {
+		location = time.Local
+	}
+	return &latencyBaseline{location: location}
+}
+
+func (b *latencyBaseline) slot(at time.Time) *baselineSlot {
+	at = at.In(b.location)
+	return &b.slots[int(at.Weekday())*24+at.Hour()]
+}
+
+// add learns one minute of latency.
+func (b *latencyBaseline) add(at time.Time, avg, p95 time.Duration) {
+	slot := b.slot(at)
+	slot.avg.add(float64(avg))
+	slot.p95.add(float64(p95))
+}
+
+// addRollups learns the minute buckets that had at least one success.
+func (b *latencyBaseline) addRollups(rollups []RollupRecord) {
+	for _, rollup := range rollups {
+		if rollup.Count > rollup.Failures {
+			b.add(rollup.Bucket, rollup.Avg, rollup.P95)
+		}
+	}
+}
+
+// learn reads the stored checks of [from, to) a day at a time, plus the
+// minute rollups of storage that has expired older checks.
+func (b *latencyBaseline) learn(reader StorageReader, deviceID string, from, to time.Time) error {
+	if rollups, ok := reader.(RollupReader); ok {
+		records, err := rollups.GetRollups(deviceID, ResolutionMinute, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to get rollups: %w", err)
+		}
+		b.addRollups(records)
+	}
+
+	for start := from; start.Before(to); start = start.Add(24 * time.Hour) {
+		end := start.Add(24 * time.Hour)
+		if end.After(to) {
+			end = to
+		}
+		checks, err := reader.GetChecks(deviceID, start, end)
+		if err != nil {
+			return fmt.Errorf("failed to get checks: %w", err)
+		}
+		b.addRollups(RollupChecks(checks, ResolutionMinute))
+	}
+	return nil
+}
+
+// check compares a window of recent latency against the baseline of its
+// hour of the week.
+func (b *latencyBaseline) check(at time.Time, window WindowStats, config AnomalyConfig) *LatencyAnomaly {
+	if window.Ticks == window.Failures {
+		return nil
+	}
+	slot := b.slot(at)
+	if slot.avg.n < config.MinSamples {
+		return nil
+	}
+
+	avgScore, avgHigh := slot.avg.exceeds(window.Avg, config)
+	p95Score, p95High := slot.p95.exceeds(window.P95, config)
+	if !avgHigh && !p95High {
+		return nil
+	}
+
+	return &LatencyAnomaly{
+		At:          at,
+		Latency:     window.Avg,
+		Expected:    time.Duration(slot.avg.mean),
+		P95:         window.P95,
+		ExpectedP95: time.Duration(slot.p95.mean),
+		Score:       max(avgScore, p95Score),
+	}
+}
+
+func (c *AnomalyConfig) validate() error {
+	defaults := DefaultAnomalyConfig()
+	if c.Deviations == 0 {
+		c.Deviations = defaults.Deviations
+	}
+	if c.MinIncrease == 0 {
+		c.MinIncrease = defaults.MinIncrease
+	}
+	if c.MinSamples == 0 {
+		c.MinSamples = defaults.MinSamples
+	}
+	if c.History == 0 {
+		c.History = defaults.History
+	}
+	if c.Location == nil {
+		c.Location = defaults.Location
+	}
+	if c.Deviations < 0 || c.MinIncrease < 0 || c.MinSamples < 0 || c.History < 0 {
+		return errors.New("anomaly settings must not be negative")
+	}
+	return nil
+}
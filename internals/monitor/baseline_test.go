@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBaseline(t *testing.T) {
+	config := DefaultAnomalyConfig()
+	config.Location = time.UTC
+	// a Friday morning
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// an hour of checks a week earlier, 20ms with a few milliseconds of noise
+	storage := NewMemoryStorage()
+	for i := 0; i < 3600; i++ {
+		latency := time.Duration(18+i%5) * time.Millisecond
+		storage.LogConnectivityCheck("dev", true, latency, start.Add(-7*24*time.Hour+time.Duration(i)*time.Second), nil)
+	}
+
+	newBaseline := func(t *testing.T) *latencyBaseline {
+		baseline := newLatencyBaseline(time.UTC)
+		if err := baseline.learn(storage, "dev", start.Add(-config.History), start); err != nil {
+			t.Fatalf("Failed to learn baseline: %v", err)
+		}
+		return baseline
+	}
+	window := func(avg, p95 time.Duration) WindowStats {
+		return WindowStats{Window: time.Minute, Ticks: 60, Avg: avg, P95: p95}
+	}
+
+	t.Run("LearnsHourOfWeek", func(t *testing.T) {
+		slot := newBaseline(t).slot(start.Add(30 * time.Minute))
+		if slot.avg.n != 60 {
+			t.Fatalf("Expected 60 minutes learned for Friday 10:00, got %d", slot.avg.n)
+		}
+		if mean := time.Duration(slot.avg.mean); mean != 20*time.Millisecond {
+			t.Errorf("Expected a baseline of 20ms, got %v", mean)
+		}
+	})
+
+	t.Run("Normal", func(t *testing.T) {
+		if anomaly := newBaseline(t).check(start, window(25*time.Millisecond, 30*time.Millisecond), config); anomaly != nil {
+			t.Errorf("Expected a few milliseconds over to be normal, got %+v", anomaly)
+		}
+	})
+
+	t.Run("AverageShift", func(t *testing.T) {
+		anomaly := newBaseline(t).check(start, window(120*time.Millisecond, 150*time.Millisecond), config)
+		if anomaly == nil {
+			t.Fatal("Expected 120ms to be anomalous")
+		}
+		if anomaly.Expected != 20*time.Millisecond || anomaly.ExpectedP95 != 22*time.Millisecond || anomaly.Score < 3 {
+			t.Errorf("Unexpected anomaly %+v", anomaly)
+		}
+	})
+
+	t.Run("PercentileShift", func(t *testing.T) {
+		// the average barely moves but the slowest ticks do
+		if anomaly := newBaseline(t).check(start, window(22*time.Millisecond, 200*time.Millisecond), config); anomaly == nil {
+			t.Error("Expected a 95th percentile of 200ms to be anomalous")
+		}
+	})
+
+	t.Run("UnknownHour", func(t *testing.T) {
+		if anomaly := newBaseline(t).check(start.Add(3*time.Hour), window(time.Second, time.Second), config); anomaly != nil {
+			t.Errorf("Expected no verdict without enough samples, got %+v", anomaly)
+		}
+	})
+}
+
+func TestMonitorLatencyAnomaly(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	config := Config{
+		CheckInterval: time.Second,
+		Targets:       []Target{{Name: "static", Prober: &staticProber{}}},
+		Clock:         clock,
+		Anomaly:       AnomalyConfig{MinSamples: 5, Location: time.UTC},
+	}
+	monitor, err := NewWithConfig(config, &recordingStorage{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	tick := func(latency time.Duration) *LatencyAnomaly {
+		clock.Advance(time.Second)
+		return monitor.observeLatency(TickResult{AverageLatency: latency})
+	}
+
+	// ten minutes at 20ms are learned as they pass
+	for i := 0; i < 600; i++ {
+		if anomaly := tick(20 * time.Millisecond); anomaly != nil {
+			t.Fatalf("Expected a steady connection not to be anomalous, got %+v", anomaly)
+		}
+	}
+	if n := monitor.baseline.slot(clock.now).avg.n; n != 10 {
+		t.Errorf("Expected the 10 finished minutes to be learned, got %d", n)
+	}
+
+	var anomaly *LatencyAnomaly
+	for i := 0; i < 60 && anomaly == nil; i++ {
+		anomaly = tick(200 * time.Millisecond)
+	}
+	if anomaly == nil || anomaly.Expected != 20*time.Millisecond {
+		t.Fatalf("Expected 200ms to be flagged against 20ms, got %+v", anomaly)
+	}
+
+	// the anomalous minute is not learned
+	for i := 0; i < 60; i++ {
+		tick(200 * time.Millisecond)
+	}
+	if mean := time.Duration(monitor.baseline.slot(clock.now).avg.mean); mean != 20*time.Millisecond {
+		t.Errorf("Expected the baseline to stay at 20ms, got %v", mean)
+	}
+}
@@ -0,0 +1,250 @@
+package monitor
+
+import (
+	"WifiTracker/internals/alerts"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Target is a probed endpoint and how much it counts towards the down decision.
+type Target struct {
+	Name   string
+	Prober Prober
+	// Weight defaults to 1 when left at zero.
+	Weight float64
+	// Critical targets can mark the connection down on their own, see Quorum.AnyCritical.
+	Critical bool
+}
+
+// Quorum decides when a round of probes counts as a failed check.
+type Quorum struct {
+	// DownFraction is the share of the total target weight that has to fail
+	// for the check to fail, in (0, 1].
+	DownFraction float64
+	// AnyCritical fails the check as soon as any critical target fails.
+	AnyCritical bool
+}
+
+type Config struct {
+	// Device identifies this monitor, a random ID is used if none is set.
+	Device        DeviceInfo
+	CheckInterval time.Duration
+	// ProbeTimeout bounds a single probe, TickTimeout the whole round. A
+	// round can't take longer than CheckInterval or ticks get dropped, and
+	// a whole burst of probes that all time out has to fit in the round.
+	// ProbeTimeout defaults to its share of TickTimeout.
+	ProbeTimeout time.Duration
+	TickTimeout  time.Duration
+	// BurstSize is how many probes each target gets per tick, spaced by
+	// BurstInterval, to measure loss and jitter.
+	BurstSize     int
+	BurstInterval time.Duration
+	Targets       []Target
+	Quorum        Quorum
+	Thresholds    Thresholds
+	Hysteresis    Hysteresis
+	// Clock defaults to the system clock.
+	Clock Clock
+	// ResumeWindow is how recent the last check of a previous run has to be
+	// for an outage it left open to be resumed rather than closed.
+	ResumeWindow time.Duration
+	// LatencyHalfLife is how fast the latency average forgets, a tick loses
+	// half its weight after this long.
+	LatencyHalfLife time.Duration
+	Anomaly         AnomalyConfig
+	// History is read on start to learn the normal latency of the device,
+	// without it the baseline is only learned while running.
+	History StorageReader
+	// Notifiers hear about outages and latency anomalies, retried as set
+	// by Notifications.
+	Notifiers     []alerts.Notifier
+	Notifications alerts.DispatcherConfig
+	// OnStorageError is called for every failed storage write. The default
+	// logs it.
+	OnStorageError func(error)
+}
+
+// DefaultConfig probes the public DNS servers over ICMP and fails a check
+// when three quarters of them do not answer.
+func DefaultConfig() Config {
+	targets := make([]Target, 0, len(defaultTargets))
+	for _, target := range defaultTargets {
+		targets = append(targets, Target{
+			Name:   target,
+			Prober: &ICMPProber{Target: target, Pinger: NewICMPPinger(defaultProbeTimeout)},
+			Weight: 1,
+		})
+	}
+
+	return Config{
+		CheckInterval: time.Second,
+		// 3 probes that time out and the 2 waits between them fit the tick
+		ProbeTimeout:  250 * time.Millisecond,
+		TickTimeout:   time.Second,
+		BurstSize:     3,
+		BurstInterval: 100 * time.Millisecond,
+		Targets:       targets,
+		Quorum:        Quorum{DownFraction: 0.75},
+		Thresholds:    DefaultThresholds(),
+		Hysteresis:    DefaultHysteresis(),
+		Clock:         realClock{},
+		ResumeWindow:  time.Minute,
+
+		LatencyHalfLife: defaultLatencyHalfLife,
+		Anomaly:         DefaultAnomalyConfig(),
+		Notifiers:       []alerts.Notifier{alerts.NewDesktopNotifier()},
+		Notifications:   alerts.DefaultDispatcherConfig(),
+	}
+}
+
+// Validate fills in defaults and reports the first invalid setting.
+func (c *Config) Validate() error {
+	if c.Clock == nil {
+		c.Clock = realClock{}
+	}
+	if c.CheckInterval <= 0 {
+		return errors.New("check interval must be positive")
+	}
+	if c.ResumeWindow == 0 {
+		c.ResumeWindow = time.Minute
+	}
+	if c.ResumeWindow < 0 {
+		return errors.New("resume window must not be negative")
+	}
+	if c.LatencyHalfLife == 0 {
+		c.LatencyHalfLife = defaultLatencyHalfLife
+	}
+	if c.LatencyHalfLife < 0 {
+		return errors.New("latency half-life must be positive")
+	}
+	if err := c.Anomaly.validate(); err != nil {
+		return err
+	}
+	for i, notifier := range c.Notifiers {
+		if notifier == nil {
+			return fmt.Errorf("notifier %d is nil", i)
+		}
+	}
+	if c.BurstSize == 0 {
+		c.BurstSize = 1
+	}
+	if c.BurstSize < 0 || c.BurstInterval < 0 {
+		return errors.New("burst size and interval must not be negative")
+	}
+	if c.TickTimeout == 0 {
+		c.TickTimeout = min(defaultProbeTimeout, c.CheckInterval)
+	}
+	if c.ProbeTimeout < 0 || c.TickTimeout < 0 {
+		return errors.New("probe and tick timeouts must be positive")
+	}
+	if c.TickTimeout > c.CheckInterval {
+		return fmt.Errorf("tick timeout %v must not be longer than the check interval %v", c.TickTimeout, c.CheckInterval)
+	}
+	// otherwise one lost probe eats the round and the rest of the burst
+	// counts as lost with it
+	share := (c.TickTimeout - time.Duration(c.BurstSize-1)*c.BurstInterval) / time.Duration(c.BurstSize)
+	if share <= 0 {
+		return fmt.Errorf("a burst of %d probes %v apart does not fit the tick timeout %v", c.BurstSize, c.BurstInterval, c.TickTimeout)
+	}
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = min(defaultProbeTimeout, share)
+	}
+	if c.ProbeTimeout > share {
+		return fmt.Errorf("probe timeout %v is more than the %v each of the %d probes of a burst gets of the tick timeout %v", c.ProbeTimeout, share, c.BurstSize, c.TickTimeout)
+	}
+	if len(c.Targets) == 0 {
+		return errors.New("at least one target is required")
+	}
+
+	names := make(map[string]bool, len(c.Targets))
+	for i := range c.Targets {
+		target := &c.Targets[i]
+		if target.Prober == nil {
+			return fmt.Errorf("target %d (%s) has no prober", i, target.Name)
+		}
+		if target.Name == "" {
+			target.Name = fmt.Sprintf("target-%d", i)
+		}
+		if names[target.Name] {
+			return fmt.Errorf("duplicate target name %q", target.Name)
+		}
+		names[target.Name] = true
+
+		if target.Weight < 0 {
+			return fmt.Errorf("target %s has negative weight", target.Name)
+		}
+		if target.Weight == 0 {
+			target.Weight = 1
+		}
+	}
+
+	if c.Quorum.DownFraction == 0 {
+		c.Quorum.DownFraction = 0.75
+	}
+	if c.Quorum.DownFraction < 0 || c.Quorum.DownFraction > 1 {
+		return fmt.Errorf("quorum down fraction %.2f must be within (0, 1]", c.Quorum.DownFraction)
+	}
+
+	defaults := DefaultThresholds()
+	if c.Thresholds.SlowLatency == 0 {
+		c.Thresholds.SlowLatency = defaults.SlowLatency
+	}
+	if c.Thresholds.LossPercent == 0 {
+		c.Thresholds.LossPercent = defaults.LossPercent
+	}
+	if c.Thresholds.Jitter == 0 {
+		c.Thresholds.Jitter = defaults.Jitter
+	}
+	if c.Thresholds.SlowLatency < 0 || c.Thresholds.Jitter < 0 {
+		return errors.New("latency thresholds must be positive")
+	}
+	if c.Thresholds.LossPercent < 0 || c.Thresholds.LossPercent > 100 {
+		return fmt.Errorf("loss threshold %.1f%% must be within [0, 100]", c.Thresholds.LossPercent)
+	}
+
+	// a zero hysteresis means none was configured
+	h := c.Hysteresis
+	if h.Enter == nil && h.Exit == nil && h.DefaultEnter == 0 && h.DefaultExit == 0 && h.FlapTransitions == 0 && h.FlapWindow == 0 {
+		c.Hysteresis = DefaultHysteresis()
+	}
+	if c.Hysteresis.DefaultEnter < 0 || c.Hysteresis.DefaultExit < 0 || c.Hysteresis.FlapTransitions < 0 {
+		return errors.New("hysteresis counts must not be negative")
+	}
+	for status, count := range c.Hysteresis.Enter {
+		if count < 0 {
+			return fmt.Errorf("enter count for %s must not be negative", status)
+		}
+	}
+	for status, count := range c.Hysteresis.Exit {
+		if count < 0 {
+			return fmt.Errorf("exit count for %s must not be negative", status)
+		}
+	}
+	if c.Hysteresis.FlapTransitions > 0 && c.Hysteresis.FlapWindow <= 0 {
+		return errors.New("flap window must be positive when flap detection is enabled")
+	}
+
+	return nil
+}
+
+// IsDown applies the quorum to one round of results, results[i] belonging
+// to targets[i].
+func (q Quorum) IsDown(targets []Target, results []ProbeResult) bool {
+	totalWeight, failedWeight := 0.0, 0.0
+
+	for i, target := range targets {
+		totalWeight += target.Weight
+		if i >= len(results) || !results[i].Success {
+			if target.Critical && q.AnyCritical {
+				return true
+			}
+			failedWeight += target.Weight
+		}
+	}
+
+	if totalWeight == 0 {
+		return false
+	}
+	return failedWeight/totalWeight >= q.DownFraction
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type staticProber struct {
+	result ProbeResult
+}
+
+func (s *staticProber) Probe(ctx context.Context) ProbeResult {
+	return s.result
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		config := Config{
+			CheckInterval: time.Second,
+			Targets:       []Target{{Prober: &staticProber{}}},
+		}
+		if err := config.Validate(); err != nil {
+			t.Fatalf("Expected valid config, got: %v", err)
+		}
+		if config.Targets[0].Weight != 1 {
+			t.Errorf("Expected default weight 1, got: %v", config.Targets[0].Weight)
+		}
+		if config.Targets[0].Name == "" {
+			t.Errorf("Expected default target name")
+		}
+		if config.TickTimeout > config.CheckInterval {
+			t.Errorf("Expected the tick timeout to fit the check interval, got %v", config.TickTimeout)
+		}
+		if config.Quorum.DownFraction != 0.75 {
+			t.Errorf("Expected default down fraction 0.75, got: %v", config.Quorum.DownFraction)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		configs := map[string]Config{
+			"no targets":     {CheckInterval: time.Second},
+			"no interval":    {Targets: []Target{{Prober: &staticProber{}}}},
+			"no prober":      {CheckInterval: time.Second, Targets: []Target{{Name: "a"}}},
+			"negative":       {CheckInterval: time.Second, Targets: []Target{{Prober: &staticProber{}, Weight: -1}}},
+			"duplicate name": {CheckInterval: time.Second, Targets: []Target{{Name: "a", Prober: &staticProber{}}, {Name: "a", Prober: &staticProber{}}}},
+			"bad quorum":     {CheckInterval: time.Second, Targets: []Target{{Prober: &staticProber{}}}, Quorum: Quorum{DownFraction: 1.5}},
+			"slow tick":      {CheckInterval: time.Second, TickTimeout: 2 * time.Second, Targets: []Target{{Prober: &staticProber{}}}},
+			"long probes":    {CheckInterval: time.Second, ProbeTimeout: time.Second, BurstSize: 3, Targets: []Target{{Prober: &staticProber{}}}},
+			"long burst":     {CheckInterval: time.Second, BurstSize: 3, BurstInterval: time.Second, Targets: []Target{{Prober: &staticProber{}}}},
+		}
+		for name, config := range configs {
+			if err := config.Validate(); err == nil {
+				t.Errorf("Expected %s to be invalid", name)
+			}
+		}
+	})
+}
+
+func TestQuorumIsDown(t *testing.T) {
+	targets := []Target{
+		{Name: "heavy", Weight: 3},
+		{Name: "light", Weight: 1},
+		{Name: "critical", Weight: 1, Critical: true},
+	}
+	ok, fail := ProbeResult{Success: true}, ProbeResult{}
+
+	weighted := Quorum{DownFraction: 0.6}
+	if !weighted.IsDown(targets, []ProbeResult{fail, ok, ok}) {
+		t.Errorf("Expected down when 60%% of weight fails")
+	}
+	if weighted.IsDown(targets, []ProbeResult{ok, fail, fail}) {
+		t.Errorf("Expected up when 40%% of weight fails")
+	}
+
+	critical := Quorum{DownFraction: 1, AnyCritical: true}
+	if !critical.IsDown(targets, []ProbeResult{ok, ok, fail}) {
+		t.Errorf("Expected down when a critical target fails")
+	}
+	if critical.IsDown(targets, []ProbeResult{ok, fail, ok}) {
+		t.Errorf("Expected up when only a normal target fails")
+	}
+}
@@ -1,5 +1,7 @@
 package monitor
 
+import "time"
+
 type ConnectionStatus int
 
 const (
@@ -7,6 +9,15 @@ const (
 	Slow
 	Down
 	Inactive
+	// degraded states, the connection is up but something is off
+	Lossy
+	HighJitter
+	DNSFailure
+	Partial
+	// Flapping replaces the status while it changes too often to be useful
+	Flapping
+	// Anomalous is latency well above what is normal for the time of the week
+	Anomalous
 )
 
 func (c ConnectionStatus) String() string {
@@ -19,7 +30,96 @@ func (c ConnectionStatus) String() string {
 		return "DOWN"
 	case Inactive:
 		return "INACTIVE"
+	case Lossy:
+		return "LOSSY"
+	case HighJitter:
+		return "HIGH_JITTER"
+	case DNSFailure:
+		return "DNS_FAILURE"
+	case Partial:
+		return "PARTIAL"
+	case Flapping:
+		return "FLAPPING"
+	case Anomalous:
+		return "ANOMALOUS"
 	default:
 		return "UNKNOWN"
 	}
 }
+
+// ParseConnectionStatus is the inverse of String.
+func ParseConnectionStatus(s string) (ConnectionStatus, bool) {
+	for status := Running; status <= Anomalous; status++ {
+		if status.String() == s {
+			return status, true
+		}
+	}
+	return Inactive, false
+}
+
+// Thresholds decide which degraded state an up connection is in.
+type Thresholds struct {
+	// SlowLatency is the average latency above which the connection is Slow.
+	SlowLatency time.Duration
+	// LossPercent is the packet loss, among targets that answered, above
+	// which the connection is Lossy.
+	LossPercent float64
+	// Jitter above this marks the connection HighJitter.
+	Jitter time.Duration
+}
+
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		SlowLatency: 3 * time.Second,
+		LossPercent: 10,
+		Jitter:      30 * time.Millisecond,
+	}
+}
+
+// Classify picks the status for a tick that did not count as down. The most
+// specific problem wins: failing DNS, then unreachable targets, then loss,
+// jitter, latency and finally a latency anomaly.
+func (t Thresholds) Classify(tick TickResult) ConnectionStatus {
+	dnsFailed, otherAnswered, anyFailed := false, false, false
+	sent, received := 0, 0
+	jitter, answered := time.Duration(0), 0
+
+	for _, result := range tick.Results {
+		if !result.Success {
+			anyFailed = true
+			if result.Protocol == ProtocolDNS {
+				dnsFailed = true
+			}
+			continue
+		}
+
+		if result.Protocol != ProtocolDNS {
+			otherAnswered = true
+		}
+		sent += result.Stats.Sent
+		received += result.Stats.Received
+		jitter += result.Stats.Jitter
+		answered++
+	}
+
+	switch {
+	case dnsFailed && otherAnswered:
+		return DNSFailure
+	case anyFailed:
+		return Partial
+	}
+
+	if sent > 0 && float64(sent-received)/float64(sent)*100 > t.LossPercent {
+		return Lossy
+	}
+	if answered > 0 && jitter/time.Duration(answered) > t.Jitter {
+		return HighJitter
+	}
+	if tick.AverageLatency > t.SlowLatency {
+		return Slow
+	}
+	if tick.Anomaly != nil {
+		return Anomalous
+	}
+	return Running
+}
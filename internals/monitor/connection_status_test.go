@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThresholdsClassify(t *testing.T) {
+	thresholds := DefaultThresholds()
+	ms := time.Millisecond
+
+	healthy := func(protocol Protocol) ProbeResult {
+		return ProbeResult{
+			Protocol: protocol,
+			Success:  true,
+			Latency:  20 * ms,
+			Stats:    ProbeStats{Sent: 10, Received: 10, Avg: 20 * ms, Jitter: ms},
+		}
+	}
+	failed := func(protocol Protocol) ProbeResult {
+		return ProbeResult{Protocol: protocol, Stats: ProbeStats{Sent: 10, Loss: 100}}
+	}
+
+	lossy := healthy(ProtocolICMP)
+	lossy.Stats.Received = 7
+
+	jittery := healthy(ProtocolICMP)
+	jittery.Stats.Jitter = 50 * ms
+
+	cases := map[string]struct {
+		tick TickResult
+		want ConnectionStatus
+	}{
+		"running": {
+			tick: TickResult{Results: []ProbeResult{healthy(ProtocolICMP), healthy(ProtocolTCP)}, AverageLatency: 20 * ms},
+			want: Running,
+		},
+		"slow": {
+			tick: TickResult{Results: []ProbeResult{healthy(ProtocolICMP)}, AverageLatency: 4 * time.Second},
+			want: Slow,
+		},
+		"partial": {
+			tick: TickResult{Results: []ProbeResult{healthy(ProtocolICMP), failed(ProtocolICMP)}},
+			want: Partial,
+		},
+		"dns failure": {
+			tick: TickResult{Results: []ProbeResult{healthy(ProtocolICMP), failed(ProtocolDNS)}},
+			want: DNSFailure,
+		},
+		"lossy": {
+			tick: TickResult{Results: []ProbeResult{lossy, healthy(ProtocolICMP)}},
+			want: Lossy,
+		},
+		"high jitter": {
+			tick: TickResult{Results: []ProbeResult{jittery}},
+			want: HighJitter,
+		},
+		"anomalous": {
+			tick: TickResult{Results: []ProbeResult{healthy(ProtocolICMP)}, AverageLatency: 20 * ms, Anomaly: &LatencyAnomaly{}},
+			want: Anomalous,
+		},
+	}
+
+	for name, c := range cases {
+		if got := thresholds.Classify(c.tick); got != c.want {
+			t.Errorf("%s: expected %s, got %s", name, c.want, got)
+		}
+	}
+
+	// a zero threshold only flags actual loss or jitter
+	strict := thresholds
+	strict.LossPercent = 0
+	strict.Jitter = 0
+	clean := healthy(ProtocolICMP)
+	clean.Stats.Jitter = 0
+	if got := strict.Classify(TickResult{Results: []ProbeResult{clean}}); got != Running {
+		t.Errorf("Expected a clean tick to be running with zero thresholds, got %s", got)
+	}
+}
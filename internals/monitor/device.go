@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// DeviceInfo identifies the machine a monitor runs on. The ID is stable
+// across restarts, the rest is for people reading the dashboard.
+type DeviceInfo struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Location string            `json:"location,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// DisplayName is the name if one is set, the ID otherwise.
+func (d DeviceInfo) DisplayName() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.ID
+}
+
+// LoadOrCreateDevice reads the device state file, creating it with a new ID
+// and the hostname as name on first run. Name, location and labels can be
+// edited in the file by hand.
+func LoadOrCreateDevice(path string) (DeviceInfo, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		var device DeviceInfo
+		if err := json.Unmarshal(content, &device); err != nil {
+			return DeviceInfo{}, fmt.Errorf("failed to parse device file %s: %w", path, err)
+		}
+		if device.ID == "" {
+			return DeviceInfo{}, fmt.Errorf("device file %s has no id", path)
+		}
+		return device, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return DeviceInfo{}, fmt.Errorf("failed to read device file %s: %w", path, err)
+	}
+
+	hostname, _ := os.Hostname()
+	device := DeviceInfo{
+		ID:   uuid.NewString(),
+		Name: hostname,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return DeviceInfo{}, fmt.Errorf("failed to create device file directory: %w", err)
+	}
+	content, err = json.MarshalIndent(device, "", "  ")
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return DeviceInfo{}, fmt.Errorf("failed to write device file %s: %w", path, err)
+	}
+
+	return device, nil
+}
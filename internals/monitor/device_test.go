@@ -0,0 +1,34 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateDevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "device.json")
+
+	first, err := LoadOrCreateDevice(path)
+	if err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	if first.ID == "" {
+		t.Fatalf("Expected a device id to be generated")
+	}
+
+	second, err := LoadOrCreateDevice(path)
+	if err != nil {
+		t.Fatalf("Failed to load device: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected stable device id %s, got: %s", first.ID, second.ID)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"name": "no id"}`), 0644); err != nil {
+		t.Fatalf("Failed to write device file: %v", err)
+	}
+	if _, err := LoadOrCreateDevice(path); err == nil {
+		t.Errorf("Expected error for device file without id")
+	}
+}
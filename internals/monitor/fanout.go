@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultSinkTimeout is how long a FanOut waits on a sink without a Timeout.
+const DefaultSinkTimeout = 10 * time.Second
+
+// Sink is one named destination of a FanOut.
+type Sink struct {
+	Name    string
+	Storage StorageWriter
+	// Timeout is how long a write may take before the FanOut stops waiting
+	// for it, so one hung sink does not hold up the others. The write itself
+	// is left to finish in the background.
+	Timeout time.Duration
+}
+
+// FanOut forwards every event to several sinks. Each sink is called even
+// when an earlier one fails or panics, and the failures come back joined,
+// each tagged with the sink name.
+type FanOut struct {
+	sinks []Sink
+	// recovery is the first sink able to report open outages
+	recovery OutageRecovery
+}
+
+var _ StorageWriter = (*FanOut)(nil)
+
+func NewFanOut(sinks ...Sink) *FanOut {
+	fanOut := &FanOut{sinks: slices.Clone(sinks)}
+	for i, sink := range fanOut.sinks {
+		if sink.Timeout <= 0 {
+			fanOut.sinks[i].Timeout = DefaultSinkTimeout
+		}
+		if recovery, ok := sink.Storage.(OutageRecovery); ok && fanOut.recovery == nil {
+			fanOut.recovery = recovery
+		}
+	}
+	return fanOut
+}
+
+// each calls fn on every sink concurrently and collects the errors. A sink
+// that is still busy after its timeout counts as failed.
+func (f *FanOut) each(fn func(sink StorageWriter) error) error {
+	errs := make([]error, len(f.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range f.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f.call(sink, fn)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (f *FanOut) call(sink Sink, fn func(sink StorageWriter) error) error {
+	// buffered so a write that finishes after the timeout does not block
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("sink %s panicked: %v", sink.Name, r)
+			}
+		}()
+
+		if err := fn(sink.Storage); err != nil {
+			result <- fmt.Errorf("sink %s: %w", sink.Name, err)
+			return
+		}
+		result <- nil
+	}()
+
+	timer := time.NewTimer(sink.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("sink %s: timed out after %v", sink.Name, sink.Timeout)
+	}
+}
+
+func (f *FanOut) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	return f.each(func(sink StorageWriter) error {
+		return sink.LogConnectivityCheck(deviceID, success, responseTime, timestamp, err)
+	})
+}
+
+func (f *FanOut) LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error {
+	return f.each(func(sink StorageWriter) error {
+		return sink.LogStatusChange(deviceID, from, to, timestamp)
+	})
+}
+
+func (f *FanOut) LogOutageStart(deviceID string, timestamp time.Time) error {
+	return f.each(func(sink StorageWriter) error {
+		return sink.LogOutageStart(deviceID, timestamp)
+	})
+}
+
+func (f *FanOut) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
+	return f.each(func(sink StorageWriter) error {
+		return sink.LogOutageEnd(deviceID, duration, timestamp)
+	})
+}
+
+func (f *FanOut) LogProbeStats(deviceID string, target string, stats ProbeStats, timestamp time.Time) error {
+	return f.each(func(sink StorageWriter) error {
+		return sink.LogProbeStats(deviceID, target, stats, timestamp)
+	})
+}
+
+func (f *FanOut) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	return f.each(func(sink StorageWriter) error {
+		return sink.LogFlapIncident(deviceID, start, end, transitions)
+	})
+}
+
+// LogLatencyAnomaly reaches the sinks that record anomalies.
+func (f *FanOut) LogLatencyAnomaly(deviceID string, anomaly LatencyAnomaly) error {
+	return f.each(func(sink StorageWriter) error {
+		if writer, ok := sink.(AnomalyWriter); ok {
+			return writer.LogLatencyAnomaly(deviceID, anomaly)
+		}
+		return nil
+	})
+}
+
+// RegisterDevice reaches the sinks that keep a device registry.
+func (f *FanOut) RegisterDevice(device DeviceInfo) error {
+	return f.each(func(sink StorageWriter) error {
+		if registry, ok := sink.(DeviceRegistry); ok {
+			return registry.RegisterDevice(device)
+		}
+		return nil
+	})
+}
+
+// Flush reaches the sinks that buffer writes.
+func (f *FanOut) Flush() error {
+	return f.each(func(sink StorageWriter) error {
+		if flusher, ok := sink.(Flusher); ok {
+			return flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// GetOpenOutage and GetLastCheck ask the first sink that can answer, the
+// interrupted flag goes to every sink that keeps it.
+func (f *FanOut) GetOpenOutage(deviceID string) (time.Time, bool, error) {
+	if f.recovery == nil {
+		return time.Time{}, false, nil
+	}
+	return f.recovery.GetOpenOutage(deviceID)
+}
+
+func (f *FanOut) GetLastCheck(deviceID string) (time.Time, bool, error) {
+	if f.recovery == nil {
+		return time.Time{}, false, nil
+	}
+	return f.recovery.GetLastCheck(deviceID)
+}
+
+func (f *FanOut) MarkOutageInterrupted(deviceID string) error {
+	return f.each(func(sink StorageWriter) error {
+		if recovery, ok := sink.(OutageRecovery); ok {
+			return recovery.MarkOutageInterrupted(deviceID)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingStorage fails or panics on every write.
+type failingStorage struct {
+	recordingStorage
+	panics bool
+}
+
+func (f *failingStorage) LogOutageStart(deviceID string, timestamp time.Time) error {
+	if f.panics {
+		panic("disk on fire")
+	}
+	return errors.New("disk full")
+}
+
+// hangingStorage blocks every outage start until released.
+type hangingStorage struct {
+	recordingStorage
+	release chan struct{}
+}
+
+func (h *hangingStorage) LogOutageStart(deviceID string, timestamp time.Time) error {
+	<-h.release
+	return nil
+}
+
+// statusFailingStorage fails every status change.
+type statusFailingStorage struct {
+	recordingStorage
+}
+
+func (s *statusFailingStorage) LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error {
+	return errors.New("disk full")
+}
+
+func TestFanOut(t *testing.T) {
+	healthy := NewMemoryStorage()
+	fanOut := NewFanOut(
+		Sink{Name: "broken", Storage: &failingStorage{}},
+		Sink{Name: "panicky", Storage: &failingStorage{panics: true}},
+		Sink{Name: "memory", Storage: healthy},
+	)
+
+	now := time.Now()
+	err := fanOut.LogOutageStart("a", now)
+	if err == nil {
+		t.Fatalf("Expected sink errors to be surfaced")
+	}
+	if !strings.Contains(err.Error(), "sink broken") || !strings.Contains(err.Error(), "sink panicky") {
+		t.Errorf("Expected errors tagged with sink names, got: %v", err)
+	}
+
+	// the healthy sink still got the event
+	if start, open, _ := healthy.GetOpenOutage("a"); !open || !start.Equal(now) {
+		t.Errorf("Expected healthy sink to record the outage")
+	}
+
+	// recovery is answered by the one sink that can
+	if _, open, err := fanOut.GetOpenOutage("a"); err != nil || !open {
+		t.Errorf("Expected open outage through the fan out, got open=%v err=%v", open, err)
+	}
+}
+
+func TestFanOutHungSink(t *testing.T) {
+	hung := &hangingStorage{release: make(chan struct{})}
+	defer close(hung.release)
+	healthy := NewMemoryStorage()
+	fanOut := NewFanOut(
+		Sink{Name: "hung", Storage: hung, Timeout: 20 * time.Millisecond},
+		Sink{Name: "memory", Storage: healthy},
+	)
+
+	began := time.Now()
+	err := fanOut.LogOutageStart("a", began)
+	if err == nil || !strings.Contains(err.Error(), "sink hung: timed out") {
+		t.Errorf("Expected the hung sink to time out, got: %v", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("Expected the fan out not to wait on the hung sink, took %v", elapsed)
+	}
+	if _, open, _ := healthy.GetOpenOutage("a"); !open {
+		t.Errorf("Expected healthy sink to record the outage")
+	}
+}
+
+func TestMonitorSurfacesStorageErrors(t *testing.T) {
+	reported := []error{}
+	config := Config{
+		CheckInterval:  time.Second,
+		Targets:        []Target{{Prober: &staticProber{}}},
+		OnStorageError: func(err error) { reported = append(reported, err) },
+	}
+	monitor, err := NewWithConfig(config, &failingStorage{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	monitor.logOutageStart(time.Now())
+	monitor.logStatusChange(Running, Down, time.Now())
+
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "log outage start") {
+		t.Errorf("Expected the failed write to be reported, got: %v", reported)
+	}
+}
+
+func TestMonitorStorageErrorReadsMonitor(t *testing.T) {
+	var monitor *WifiMonitor
+	reported := make(chan ConnectionStatus, 10)
+	config := Config{
+		CheckInterval: time.Second,
+		Targets:       []Target{{Prober: &staticProber{}}},
+		// the handler reading the monitor must not deadlock on its lock
+		OnStorageError: func(err error) { reported <- monitor.GetStatus() },
+	}
+	monitor, err := NewWithConfig(config, &statusFailingStorage{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		monitor.applyTick(TickResult{Down: true}, Transition{
+			Status:  Down,
+			Changes: []StatusChange{{From: Running, To: Down}},
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected applyTick to finish, it deadlocked")
+	}
+	if status := <-reported; status != Down {
+		t.Errorf("Expected the handler to see the new status, got %s", status)
+	}
+}
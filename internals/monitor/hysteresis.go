@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"time"
+)
+
+// Hysteresis damps status changes. A new status has to be observed on
+// enough consecutive ticks to both enter it and leave the current one, and
+// too many changes inside FlapWindow put the monitor into Flapping.
+type Hysteresis struct {
+	// Enter and Exit override the number of consecutive ticks needed to
+	// enter or leave a given status.
+	Enter        map[ConnectionStatus]int
+	Exit         map[ConnectionStatus]int
+	DefaultEnter int
+	DefaultExit  int
+
+	// FlapTransitions changes within FlapWindow raise Flapping. Flapping
+	// clears once a whole window passes without a change.
+	FlapTransitions int
+	FlapWindow      time.Duration
+}
+
+func DefaultHysteresis() Hysteresis {
+	return Hysteresis{
+		Enter:           map[ConnectionStatus]int{Down: 3},
+		Exit:            map[ConnectionStatus]int{Down: 2},
+		DefaultEnter:    2,
+		DefaultExit:     1,
+		FlapTransitions: 6,
+		FlapWindow:      2 * time.Minute,
+	}
+}
+
+func (h Hysteresis) required(from, to ConnectionStatus) int {
+	enter, ok := h.Enter[to]
+	if !ok {
+		enter = h.DefaultEnter
+	}
+	exit, ok := h.Exit[from]
+	if !ok {
+		exit = h.DefaultExit
+	}
+	return max(enter, exit, 1)
+}
+
+// StatusChange is a change that should be written to the status log.
+type StatusChange struct {
+	From, To ConnectionStatus
+}
+
+// FlapIncident covers a whole Flapping period.
+type FlapIncident struct {
+	Start, End  time.Time
+	Transitions int
+}
+
+// statusTracker applies Hysteresis to the raw per tick status.
+type statusTracker struct {
+	config Hysteresis
+
+	// current is the debounced status, even while flapping
+	current   ConnectionStatus
+	candidate ConnectionStatus
+	streak    int
+
+	transitions []time.Time
+	flapping    bool
+	flapStart   time.Time
+	flapCount   int
+}
+
+func newStatusTracker(config Hysteresis, initial ConnectionStatus) *statusTracker {
+	return &statusTracker{
+		config:    config,
+		current:   initial,
+		candidate: initial,
+	}
+}
+
+// Reported is the status the outside world sees, Flapping while flapping.
+func (s *statusTracker) Reported() ConnectionStatus {
+	if s.flapping {
+		return Flapping
+	}
+	return s.current
+}
+
+// observe feeds one tick's raw status. It returns the status changes to
+// log and, when flapping ends, the incident that covers it.
+func (s *statusTracker) observe(observed ConnectionStatus, now time.Time) ([]StatusChange, *FlapIncident) {
+	switch observed {
+	case s.current:
+		s.candidate, s.streak = s.current, 0
+	case s.candidate:
+		s.streak++
+	default:
+		s.candidate, s.streak = observed, 1
+	}
+
+	s.pruneTransitions(now)
+
+	if s.candidate != s.current && s.streak >= s.config.required(s.current, s.candidate) {
+		from := s.current
+		s.current, s.streak = s.candidate, 0
+		s.transitions = append(s.transitions, now)
+
+		if s.flapping {
+			s.flapCount++
+			return nil, nil
+		}
+
+		if s.config.FlapTransitions > 0 && len(s.transitions) >= s.config.FlapTransitions {
+			s.flapping = true
+			s.flapStart = now
+			s.flapCount = len(s.transitions)
+			return []StatusChange{{From: from, To: Flapping}}, nil
+		}
+
+		return []StatusChange{{From: from, To: s.current}}, nil
+	}
+
+	if s.flapping && len(s.transitions) == 0 {
+		s.flapping = false
+		incident := &FlapIncident{Start: s.flapStart, End: now, Transitions: s.flapCount}
+		return []StatusChange{{From: Flapping, To: s.current}}, incident
+	}
+
+	return nil, nil
+}
+
+func (s *statusTracker) pruneTransitions(now time.Time) {
+	cutoff := now.Add(-s.config.FlapWindow)
+	kept := s.transitions[:0]
+	for _, at := range s.transitions {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	s.transitions = kept
+}
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusTrackerHysteresis(t *testing.T) {
+	config := Hysteresis{
+		Enter:        map[ConnectionStatus]int{Down: 3},
+		Exit:         map[ConnectionStatus]int{Down: 2},
+		DefaultEnter: 2,
+		DefaultExit:  1,
+	}
+	tracker := newStatusTracker(config, Running)
+	now := time.Now()
+
+	observe := func(status ConnectionStatus) []StatusChange {
+		now = now.Add(time.Second)
+		changes, _ := tracker.observe(status, now)
+		return changes
+	}
+
+	// a single slow tick is not enough to leave Running
+	if changes := observe(Slow); len(changes) != 0 {
+		t.Errorf("Expected no change after one slow tick, got: %v", changes)
+	}
+	if changes := observe(Running); len(changes) != 0 {
+		t.Errorf("Expected no change when back to running, got: %v", changes)
+	}
+
+	observe(Down)
+	observe(Down)
+	if tracker.Reported() != Running {
+		t.Errorf("Expected to stay running before three down ticks, got: %s", tracker.Reported())
+	}
+	if changes := observe(Down); len(changes) != 1 || changes[0].To != Down {
+		t.Errorf("Expected change to down on the third tick, got: %v", changes)
+	}
+
+	// leaving down takes two good ticks
+	if changes := observe(Running); len(changes) != 0 {
+		t.Errorf("Expected to stay down after one good tick, got: %v", changes)
+	}
+	if changes := observe(Running); len(changes) != 1 || changes[0].From != Down || changes[0].To != Running {
+		t.Errorf("Expected change back to running, got: %v", changes)
+	}
+}
+
+func TestStatusTrackerFlapping(t *testing.T) {
+	config := Hysteresis{
+		DefaultEnter:    1,
+		DefaultExit:     1,
+		FlapTransitions: 4,
+		FlapWindow:      time.Minute,
+	}
+	tracker := newStatusTracker(config, Running)
+	now := time.Now()
+
+	logged := []StatusChange{}
+	var incident *FlapIncident
+	observe := func(status ConnectionStatus) {
+		now = now.Add(time.Second)
+		changes, flap := tracker.observe(status, now)
+		logged = append(logged, changes...)
+		if flap != nil {
+			incident = flap
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		observe(Slow)
+		observe(Running)
+	}
+
+	if tracker.Reported() != Flapping {
+		t.Fatalf("Expected flapping, got: %s", tracker.Reported())
+	}
+	// three regular changes and then one into flapping, nothing after
+	if len(logged) != 4 || logged[3].To != Flapping {
+		t.Errorf("Expected flaps to be suppressed, got: %v", logged)
+	}
+
+	for i := 0; i < 61; i++ {
+		observe(Running)
+	}
+
+	if tracker.Reported() != Running {
+		t.Errorf("Expected flapping to clear after a quiet window, got: %s", tracker.Reported())
+	}
+	if incident == nil || incident.Transitions != 20 {
+		t.Errorf("Expected a single incident covering 20 transitions, got: %+v", incident)
+	}
+	if last := logged[len(logged)-1]; last.From != Flapping || last.To != Running {
+		t.Errorf("Expected change out of flapping, got: %v", last)
+	}
+}
@@ -0,0 +1,234 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+var ErrEchoTimeout = errors.New("icmp echo timed out")
+
+// EchoReply is the result of a single ICMP echo round trip.
+type EchoReply struct {
+	Source net.Addr
+	Seq    int
+	TTL    int
+	RTT    time.Duration
+}
+
+// ICMPPinger sends ICMP echo requests from inside the process. It uses
+// unprivileged datagram sockets where the OS allows them and falls back to
+// raw sockets otherwise.
+type ICMPPinger struct {
+	Timeout time.Duration
+
+	id int
+}
+
+// echoSeq is shared by every pinger. They all use the process id, so a
+// per pinger counter would hand out the same sequence numbers to targets
+// probed at the same time.
+var echoSeq atomic.Uint32
+
+func NewICMPPinger(timeout time.Duration) *ICMPPinger {
+	return &ICMPPinger{
+		Timeout: timeout,
+		id:      os.Getpid() & 0xffff,
+	}
+}
+
+// Echo sends one echo request to target and waits for the matching reply.
+func (p *ICMPPinger) Echo(ctx context.Context, target string) (EchoReply, error) {
+	if err := ctx.Err(); err != nil {
+		return EchoReply{}, err
+	}
+
+	ip, err := resolveIP(ctx, target)
+	if err != nil {
+		return EchoReply{}, err
+	}
+
+	conn, privileged, err := listenICMP(ip)
+	if err != nil {
+		return EchoReply{}, err
+	}
+	defer conn.Close()
+
+	// ttl reporting is best effort, not every platform supports it
+	if p4 := conn.IPv4PacketConn(); p4 != nil {
+		p4.SetControlMessage(ipv4.FlagTTL, true)
+	} else if p6 := conn.IPv6PacketConn(); p6 != nil {
+		p6.SetControlMessage(ipv6.FlagHopLimit, true)
+	}
+
+	deadline := time.Now().Add(p.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return EchoReply{}, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	// unblock the read if the caller gives up early
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	seq := int(echoSeq.Add(1) & 0xffff)
+	proto := protocolICMP
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	if ip.To4() == nil {
+		proto = protocolIPv6ICMP
+		echoType = ipv6.ICMPTypeEchoRequest
+	}
+
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: []byte("WifiTracker")},
+	}
+	payload, err := msg.Marshal(nil)
+	if err != nil {
+		return EchoReply{}, fmt.Errorf("failed to marshal echo: %w", err)
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(payload, dst); err != nil {
+		return EchoReply{}, fmt.Errorf("failed to send echo: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, ttl, src, err := readICMP(conn, buf)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return EchoReply{}, ctxErr
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return EchoReply{}, ErrEchoTimeout
+			}
+			return EchoReply{}, fmt.Errorf("failed to read reply: %w", err)
+		}
+		rtt := time.Since(start)
+
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply.Type != ipv4.ICMPTypeEchoReply && reply.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq {
+			continue
+		}
+		// raw sockets see the replies of every target
+		if from := addrIP(src); from != nil && !from.Equal(ip) {
+			continue
+		}
+		// datagram sockets rewrite the id and the kernel filters replies for us
+		if privileged && echo.ID != p.id {
+			continue
+		}
+
+		return EchoReply{Source: src, Seq: seq, TTL: ttl, RTT: rtt}, nil
+	}
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+func resolveIP(ctx context.Context, target string) (net.IP, error) {
+	if ip := net.ParseIP(target); ip != nil {
+		return ip, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", target, err)
+	}
+	for _, addr := range addrs {
+		if addr.To4() != nil {
+			return addr, nil
+		}
+	}
+	return addrs[0], nil
+}
+
+// listenICMP opens an unprivileged ICMP socket, falling back to a raw one.
+// The bool reports whether the raw socket was used.
+func listenICMP(ip net.IP) (*icmp.PacketConn, bool, error) {
+	datagram, raw := "udp4", "ip4:icmp"
+	address := "0.0.0.0"
+	if ip.To4() == nil {
+		datagram, raw = "udp6", "ip6:ipv6-icmp"
+		address = "::"
+	}
+
+	conn, err := icmp.ListenPacket(datagram, address)
+	if err == nil {
+		return conn, false, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(raw, address)
+	if rawErr != nil {
+		return nil, false, fmt.Errorf("failed to open icmp socket: %w", errors.Join(err, rawErr))
+	}
+	return conn, true, nil
+}
+
+// readICMP reads one message along with its TTL (hop limit for IPv6) when
+// the platform reports it.
+func readICMP(conn *icmp.PacketConn, buf []byte) (int, int, net.Addr, error) {
+	if p4 := conn.IPv4PacketConn(); p4 != nil {
+		n, cm, src, err := p4.ReadFrom(buf)
+		ttl := 0
+		if cm != nil {
+			ttl = cm.TTL
+		}
+		return n, ttl, src, err
+	}
+
+	if p6 := conn.IPv6PacketConn(); p6 != nil {
+		n, cm, src, err := p6.ReadFrom(buf)
+		ttl := 0
+		if cm != nil {
+			ttl = cm.HopLimit
+		}
+		return n, ttl, src, err
+	}
+
+	n, src, err := conn.ReadFrom(buf)
+	return n, 0, src, err
+}
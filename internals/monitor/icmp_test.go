@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestICMPPingerLoopback(t *testing.T) {
+	pinger := NewICMPPinger(time.Second)
+
+	reply, err := pinger.Echo(context.Background(), "127.0.0.1")
+	if err != nil {
+		// sandboxes and CI runners often forbid icmp sockets entirely
+		t.Skipf("icmp not available: %v", err)
+	}
+
+	if reply.RTT <= 0 {
+		t.Errorf("Expected positive rtt, got: %v", reply.RTT)
+	}
+	if reply.Source == nil {
+		t.Errorf("Expected reply source to be set")
+	}
+}
+
+func TestICMPPingerCancelled(t *testing.T) {
+	pinger := NewICMPPinger(5 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 192.0.2.0/24 is reserved for documentation and never answers
+	if _, err := pinger.Echo(ctx, "192.0.2.1"); err == nil {
+		t.Errorf("Expected error for cancelled echo")
+	}
+}
+
+func TestICMPPingerConcurrentTargets(t *testing.T) {
+	pinger := NewICMPPinger(time.Second)
+	if _, err := pinger.Echo(context.Background(), "127.0.0.1"); err != nil {
+		t.Skipf("icmp not available: %v", err)
+	}
+
+	// two pingers share the process id, each must get its own target's reply
+	other := NewICMPPinger(time.Second)
+	targets := []string{"127.0.0.1", "127.0.0.2"}
+	replies := make([]EchoReply, len(targets))
+	errs := make([]error, len(targets))
+
+	var wg sync.WaitGroup
+	for i, p := range []*ICMPPinger{pinger, other} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replies[i], errs[i] = p.Echo(context.Background(), targets[i])
+		}()
+	}
+	wg.Wait()
+
+	for i, target := range targets {
+		if errs[i] != nil {
+			t.Skipf("icmp to %s not available: %v", target, errs[i])
+		}
+		if ip := addrIP(replies[i].Source); ip != nil && !ip.Equal(net.ParseIP(target)) {
+			t.Errorf("Expected the reply of %s, got one from %v", target, replies[i].Source)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// the windows reported in LatencyStats, shortest first
+var latencyWindows = []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+
+// WindowStats summarises the ticks of the last Window. Latencies only cover
+// the ticks that were up.
+type WindowStats struct {
+	Window   time.Duration
+	Ticks    int
+	Failures int
+	Avg      time.Duration
+	P95      time.Duration
+	Max      time.Duration
+}
+
+// LatencyStats is the recent latency of a monitor. EWMA is an exponentially
+// weighted average where a sample loses half its weight every half-life.
+type LatencyStats struct {
+	EWMA    time.Duration
+	Windows []WindowStats
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+	ok      bool
+}
+
+// latencyTracker keeps the samples of the longest window and the EWMA. It
+// is not safe for concurrent use, the monitor guards it with its lock.
+type latencyTracker struct {
+	halfLife time.Duration
+	samples  []latencySample
+
+	ewma    float64
+	hasEWMA bool
+	lastAt  time.Time
+}
+
+func newLatencyTracker(halfLife time.Duration) *latencyTracker {
+	return &latencyTracker{halfLife: halfLife}
+}
+
+func (t *latencyTracker) observe(at time.Time, latency time.Duration, ok bool) {
+	t.samples = append(t.samples, latencySample{at: at, latency: latency, ok: ok})
+	t.evict(at)
+
+	if !ok {
+		return
+	}
+	if !t.hasEWMA {
+		t.ewma, t.hasEWMA = float64(latency), true
+	} else {
+		// decay by the time since the last sample, so irregular ticks
+		// weigh the same as regular ones
+		elapsed := at.Sub(t.lastAt)
+		alpha := 1 - math.Exp2(-float64(elapsed)/float64(t.halfLife))
+		t.ewma += alpha * (float64(latency) - t.ewma)
+	}
+	t.lastAt = at
+}
+
+func (t *latencyTracker) evict(now time.Time) {
+	cutoff := now.Add(-latencyWindows[len(latencyWindows)-1])
+	i := 0
+	for i < len(t.samples) && !t.samples[i].at.After(cutoff) {
+		i++
+	}
+	if i > 0 {
+		t.samples = slices.Delete(t.samples, 0, i)
+	}
+}
+
+func (t *latencyTracker) stats(now time.Time) LatencyStats {
+	stats := LatencyStats{EWMA: time.Duration(t.ewma)}
+	for _, window := range latencyWindows {
+		stats.Windows = append(stats.Windows, t.window(now, window))
+	}
+	return stats
+}
+
+func (t *latencyTracker) window(now time.Time, window time.Duration) WindowStats {
+	cutoff := now.Add(-window)
+	ws := WindowStats{Window: window}
+	latencies := []time.Duration{}
+	total := time.Duration(0)
+
+	for i := len(t.samples) - 1; i >= 0 && t.samples[i].at.After(cutoff); i-- {
+		sample := t.samples[i]
+		ws.Ticks++
+		if !sample.ok {
+			ws.Failures++
+			continue
+		}
+		latencies = append(latencies, sample.latency)
+		total += sample.latency
+	}
+
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		ws.Avg = total / time.Duration(len(latencies))
+		ws.P95 = percentile(latencies, 95)
+		ws.Max = latencies[len(latencies)-1]
+	}
+	return ws
+}
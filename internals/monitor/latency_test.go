@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Windows", func(t *testing.T) {
+		tracker := newLatencyTracker(time.Minute)
+
+		// an hour at 10ms, then a minute at 100ms with one failure
+		now := start
+		for i := 0; i < 3600; i++ {
+			now = now.Add(time.Second)
+			tracker.observe(now, 10*time.Millisecond, true)
+		}
+		for i := 0; i < 60; i++ {
+			now = now.Add(time.Second)
+			tracker.observe(now, 100*time.Millisecond, i != 30)
+		}
+
+		stats := tracker.stats(now)
+		if len(stats.Windows) != 3 {
+			t.Fatalf("Expected 3 windows, got %d", len(stats.Windows))
+		}
+
+		minute := stats.Windows[0]
+		if minute.Ticks != 60 || minute.Failures != 1 || minute.Avg != 100*time.Millisecond {
+			t.Errorf("Expected the last minute at 100ms, got %+v", minute)
+		}
+		fiveMinutes := stats.Windows[1]
+		if fiveMinutes.Ticks != 300 || fiveMinutes.Avg <= 10*time.Millisecond || fiveMinutes.Avg >= 100*time.Millisecond {
+			t.Errorf("Expected the spike diluted over 5 minutes, got %+v", fiveMinutes)
+		}
+		hour := stats.Windows[2]
+		// the spike is under 5% of the hour, it only shows in the max
+		if hour.Ticks != 3600 || hour.Max != 100*time.Millisecond || hour.P95 != 10*time.Millisecond {
+			t.Errorf("Expected an hour of ticks with the spike at the top, got %+v", hour)
+		}
+		if len(tracker.samples) > 3600 {
+			t.Errorf("Expected samples older than an hour to be dropped, kept %d", len(tracker.samples))
+		}
+	})
+
+	t.Run("EWMAHalfLife", func(t *testing.T) {
+		tracker := newLatencyTracker(time.Minute)
+		tracker.observe(start, 10*time.Millisecond, true)
+		// one half-life later the new sample gets half the weight
+		tracker.observe(start.Add(time.Minute), 30*time.Millisecond, true)
+
+		if ewma := tracker.stats(start.Add(time.Minute)).EWMA; ewma != 20*time.Millisecond {
+			t.Errorf("Expected an EWMA of 20ms, got %v", ewma)
+		}
+
+		// failures don't move it
+		tracker.observe(start.Add(2*time.Minute), 0, false)
+		if ewma := tracker.stats(start.Add(2 * time.Minute)).EWMA; ewma != 20*time.Millisecond {
+			t.Errorf("Expected failures to leave the EWMA at 20ms, got %v", ewma)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		stats := newLatencyTracker(time.Minute).stats(start)
+		if stats.EWMA != 0 || stats.Windows[0].Ticks != 0 || stats.Windows[0].Avg != 0 {
+			t.Errorf("Expected empty stats, got %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"time"
+)
+
+// LogFormat is the line format of the WifiLogger.
+type LogFormat int
+
+const (
+	// FormatText is the human readable format, one sentence per event.
+	FormatText LogFormat = iota
+	// FormatJSON writes JSON Lines, one LogEvent object per line.
+	FormatJSON
+)
+
+// event types of a LogEvent
+const (
+	EventConnectivityCheck = "connectivity_check"
+	EventStatusChange      = "status_change"
+	EventOutageStart       = "outage_start"
+	EventOutageEnd         = "outage_end"
+	EventProbeStats        = "probe_stats"
+	EventFlapIncident      = "flap_incident"
+	EventLatencyAnomaly    = "latency_anomaly"
+)
+
+// LogEvent is one line of the JSON Lines log. Only the fields of its type
+// are set, latencies and durations are in milliseconds.
+type LogEvent struct {
+	Type      string    `json:"type"`
+	Device    string    `json:"device"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// connectivity checks, Latency is also the latency of an anomaly
+	Success *bool   `json:"success,omitempty"`
+	Latency float64 `json:"latency_ms,omitempty"`
+	Error   string  `json:"error,omitempty"`
+
+	// status changes
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// outage ends
+	Duration float64 `json:"duration_ms,omitempty"`
+
+	// probe stats
+	Target string         `json:"target,omitempty"`
+	Stats  *LogEventStats `json:"stats,omitempty"`
+
+	// flap incidents, Timestamp is when the flapping ended
+	Start       *time.Time `json:"start,omitempty"`
+	Transitions int        `json:"transitions,omitempty"`
+
+	// latency anomalies
+	Expected    float64 `json:"expected_ms,omitempty"`
+	P95         float64 `json:"p95_ms,omitempty"`
+	ExpectedP95 float64 `json:"expected_p95_ms,omitempty"`
+	Score       float64 `json:"score,omitempty"`
+}
+
+type LogEventStats struct {
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss_percent"`
+	Min      float64 `json:"min_ms"`
+	Avg      float64 `json:"avg_ms"`
+	Max      float64 `json:"max_ms"`
+	Jitter   float64 `json:"jitter_ms"`
+}
@@ -2,18 +2,46 @@
 package monitor
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
+
+	"WifiTracker/util"
 )
 
 // Wifi Logger
 type WifiLogger struct {
-	logFile string
+	logFile  string
+	format   LogFormat
+	rotation RotationOptions
+	now      func() time.Time
+
+	// the file is opened on the first write and kept open
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// compression and cleanup of rotated files run in the background
+	rotateMu   sync.Mutex
+	background sync.WaitGroup
+}
+
+// LoggerOptions configures a WifiLogger, the zero value is the text format
+// without rotation.
+type LoggerOptions struct {
+	Format   LogFormat
+	Rotation RotationOptions
 }
 
 func NewWifiLogger(logFile string) (*WifiLogger, error) {
+	return NewWifiLoggerWithOptions(logFile, LoggerOptions{})
+}
+
+func NewWifiLoggerWithOptions(logFile string, options LoggerOptions) (*WifiLogger, error) {
 	// create the logfile
 	dir := filepath.Dir(logFile)
 
@@ -23,7 +51,10 @@ func NewWifiLogger(logFile string) (*WifiLogger, error) {
 	}
 
 	return &WifiLogger{
-		logFile: logFile,
+		logFile:  logFile,
+		format:   options.Format,
+		rotation: options.Rotation,
+		now:      time.Now,
 	}, nil
 }
 
@@ -36,12 +67,92 @@ func (f *WifiLogger) openLogFile() (*os.File, error) {
 	return openFile, nil
 }
 
-func (f *WifiLogger) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+func (f *WifiLogger) write(logMessage string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.shouldRotate(len(logMessage)) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+
+	n, writeErr := f.file.WriteString(logMessage)
+	f.size += int64(n)
+	return writeErr
+}
+
+// open opens the log file for appending, the caller holds the lock.
+func (f *WifiLogger) open() error {
 	file, openErr := f.openLogFile()
 	if openErr != nil {
 		return openErr
 	}
-	defer file.Close()
+	info, statErr := file.Stat()
+	if statErr != nil {
+		file.Close()
+		return statErr
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	if f.size > 0 {
+		if first, ok := firstLineTime(f.logFile); ok && first.Before(f.openedAt) {
+			f.openedAt = first
+		}
+	}
+	return nil
+}
+
+func (f *WifiLogger) writeEvent(event LogEvent) error {
+	event.Timestamp = event.Timestamp.UTC()
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+	return f.write(string(line) + "\n")
+}
+
+// Flush syncs the log file to disk.
+func (f *WifiLogger) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the log file and waits for rotated files to be compressed.
+func (f *WifiLogger) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer f.background.Wait()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *WifiLogger) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	if f.format == FormatJSON {
+		event := LogEvent{Type: EventConnectivityCheck, Device: deviceID, Timestamp: timestamp, Success: &success, Latency: util.DurationMs(responseTime)}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		return f.writeEvent(event)
+	}
 
 	var logMessage string
 	if success {
@@ -50,47 +161,81 @@ func (f *WifiLogger) LogConnectivityCheck(deviceID string, success bool, respons
 		logMessage = fmt.Sprintf("[%s] DEVICE: %s FAILED TO CONNECT IN %.2f SECONDS, ERROR: %v\n", timestamp.Format(time.RFC3339), deviceID, responseTime.Seconds(), err)
 	}
 
-	_, writeErr := file.WriteString(logMessage)
-	return writeErr
+	return f.write(logMessage)
 }
 
 func (f *WifiLogger) LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error {
-	file, openErr := f.openLogFile()
-	if openErr != nil {
-		return openErr
+	if f.format == FormatJSON {
+		return f.writeEvent(LogEvent{Type: EventStatusChange, Device: deviceID, Timestamp: timestamp, From: from.String(), To: to.String()})
 	}
-	defer file.Close()
 
 	logMessage := fmt.Sprintf("[%s] DEVICE: %s STATUS CHANGE: %s -> %s\n", timestamp.Format(time.RFC3339), deviceID, from, to)
-	_, writeErr := file.WriteString(logMessage)
-	return writeErr
+	return f.write(logMessage)
 }
 
 func (f *WifiLogger) LogOutageStart(deviceID string, timestamp time.Time) error {
-	file, openErr := f.openLogFile()
-	if openErr != nil {
-		return openErr
+	if f.format == FormatJSON {
+		return f.writeEvent(LogEvent{Type: EventOutageStart, Device: deviceID, Timestamp: timestamp})
 	}
-	defer file.Close()
 
 	logMessage := fmt.Sprintf("[%s] DEVICE: %s OUTAGE START\n", timestamp.Format(time.RFC3339), deviceID)
-	_, writeErr := file.WriteString(logMessage)
-	return writeErr
+	return f.write(logMessage)
 }
 
 func (f *WifiLogger) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
-	file, openErr := f.openLogFile()
-	if openErr != nil {
-		return openErr
+	if f.format == FormatJSON {
+		return f.writeEvent(LogEvent{Type: EventOutageEnd, Device: deviceID, Timestamp: timestamp, Duration: util.DurationMs(duration)})
 	}
-	defer file.Close()
 
 	logMessage := fmt.Sprintf("[%s] DEVICE: %s OUTAGE END: LASTED %.0f SECONDS\n", timestamp.Format(time.RFC3339), deviceID, duration.Seconds())
-	_, writeErr := file.WriteString(logMessage)
-	return writeErr
+	return f.write(logMessage)
+}
+
+func (f *WifiLogger) LogProbeStats(deviceID string, target string, stats ProbeStats, timestamp time.Time) error {
+	if f.format == FormatJSON {
+		return f.writeEvent(LogEvent{Type: EventProbeStats, Device: deviceID, Timestamp: timestamp, Target: target, Stats: &LogEventStats{
+			Sent:     stats.Sent,
+			Received: stats.Received,
+			Loss:     stats.Loss,
+			Min:      util.DurationMs(stats.Min),
+			Avg:      util.DurationMs(stats.Avg),
+			Max:      util.DurationMs(stats.Max),
+			Jitter:   util.DurationMs(stats.Jitter),
+		}})
+	}
+
+	logMessage := fmt.Sprintf("[%s] DEVICE: %s TARGET: %s SENT %d RECEIVED %d LOSS %.1f%% RTT MIN/AVG/MAX %.2f/%.2f/%.2f MS JITTER %.2f MS\n",
+		timestamp.Format(time.RFC3339), deviceID, target, stats.Sent, stats.Received, stats.Loss,
+		util.DurationMs(stats.Min), util.DurationMs(stats.Avg), util.DurationMs(stats.Max), util.DurationMs(stats.Jitter))
+	return f.write(logMessage)
 }
 
-// GetDeviceStats is a stub for the logger, as it does not store stats in a queryable way.
-func (f *WifiLogger) GetDeviceStats(deviceID string, since time.Time) (*DeviceData, error) {
-	return nil, fmt.Errorf("GetDeviceStats not supported for WifiLogger (logfile only)")
+func (f *WifiLogger) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	if f.format == FormatJSON {
+		start = start.UTC()
+		return f.writeEvent(LogEvent{Type: EventFlapIncident, Device: deviceID, Timestamp: end, Start: &start, Transitions: transitions})
+	}
+
+	logMessage := fmt.Sprintf("[%s] DEVICE: %s FLAPPING FROM %s: %d TRANSITIONS\n", end.Format(time.RFC3339), deviceID, start.Format(time.RFC3339), transitions)
+	return f.write(logMessage)
+}
+
+func (f *WifiLogger) LogLatencyAnomaly(deviceID string, anomaly LatencyAnomaly) error {
+	if f.format == FormatJSON {
+		return f.writeEvent(LogEvent{
+			Type:        EventLatencyAnomaly,
+			Device:      deviceID,
+			Timestamp:   anomaly.At,
+			Latency:     util.DurationMs(anomaly.Latency),
+			Expected:    util.DurationMs(anomaly.Expected),
+			P95:         util.DurationMs(anomaly.P95),
+			ExpectedP95: util.DurationMs(anomaly.ExpectedP95),
+			Score:       anomaly.Score,
+		})
+	}
+
+	logMessage := fmt.Sprintf("[%s] DEVICE: %s LATENCY ANOMALY: AVG %.2f MS EXPECTED %.2f MS P95 %.2f MS EXPECTED %.2f MS SCORE %.2f\n",
+		anomaly.At.Format(time.RFC3339), deviceID, util.DurationMs(anomaly.Latency), util.DurationMs(anomaly.Expected),
+		util.DurationMs(anomaly.P95), util.DurationMs(anomaly.ExpectedP95), anomaly.Score)
+	return f.write(logMessage)
 }
@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -101,4 +102,54 @@ func TestWifiLogger(t *testing.T) {
 		}
 	})
 
+	t.Run("JSONLines", func(t *testing.T) {
+		tempDir := t.TempDir()
+		logFile := filepath.Join(tempDir, "test.log")
+
+		myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{Format: FormatJSON})
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		defer myLogger.Close()
+
+		deviceID := uuid.NewString()
+		now := time.Now()
+		myLogger.LogConnectivityCheck(deviceID, false, 1500*time.Millisecond, now, fmt.Errorf("connection timeout"))
+		myLogger.LogStatusChange(deviceID, Running, Down, now)
+		myLogger.LogOutageEnd(deviceID, 5*time.Second, now)
+
+		content, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatalf("Failed to read log file: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("Expected 3 lines, got %d: %s", len(lines), content)
+		}
+
+		events := make([]LogEvent, len(lines))
+		for i, line := range lines {
+			if err := json.Unmarshal([]byte(line), &events[i]); err != nil {
+				t.Fatalf("Failed to parse line %q: %v", line, err)
+			}
+		}
+
+		check := events[0]
+		if check.Type != EventConnectivityCheck || check.Device != deviceID || check.Success == nil || *check.Success {
+			t.Errorf("Expected a failed check of %s, got %+v", deviceID, check)
+		}
+		if check.Latency != 1500 || check.Error != "connection timeout" {
+			t.Errorf("Expected 1500ms and the error, got %v %q", check.Latency, check.Error)
+		}
+		if !check.Timestamp.Equal(now) {
+			t.Errorf("Expected timestamp %v, got %v", now, check.Timestamp)
+		}
+		if events[1].From != "RUNNING" || events[1].To != "DOWN" {
+			t.Errorf("Expected RUNNING -> DOWN, got %s -> %s", events[1].From, events[1].To)
+		}
+		if events[2].Type != EventOutageEnd || events[2].Duration != 5000 {
+			t.Errorf("Expected outage end of 5000ms, got %+v", events[2])
+		}
+	})
 }
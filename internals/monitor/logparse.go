@@ -0,0 +1,221 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnrecognizedLine is returned for lines that match none of the formats
+// the WifiLogger writes.
+var ErrUnrecognizedLine = errors.New("unrecognized log line")
+
+var (
+	textLinePattern = regexp.MustCompile(`^\[([^\]]+)\] DEVICE: (\S*) (.*)$`)
+
+	checkSuccessPattern = regexp.MustCompile(`^CONNECTED IN ([\d.]+) SECONDS$`)
+	checkFailurePattern = regexp.MustCompile(`^FAILED TO CONNECT IN ([\d.]+) SECONDS, ERROR: (.*)$`)
+	statusChangePattern = regexp.MustCompile(`^STATUS CHANGE: (\S+) -> (\S+)$`)
+	outageEndPattern    = regexp.MustCompile(`^OUTAGE END: LASTED ([\d.]+) SECONDS$`)
+	probeStatsPattern   = regexp.MustCompile(`^TARGET: (\S+) SENT (\d+) RECEIVED (\d+) LOSS ([\d.]+)% RTT MIN/AVG/MAX ([\d.]+)/([\d.]+)/([\d.]+) MS JITTER ([\d.]+) MS$`)
+	flapPattern         = regexp.MustCompile(`^FLAPPING FROM (\S+): (\d+) TRANSITIONS$`)
+	anomalyPattern      = regexp.MustCompile(`^LATENCY ANOMALY: AVG ([\d.]+) MS EXPECTED ([\d.]+) MS P95 ([\d.]+) MS EXPECTED ([\d.]+) MS SCORE (-?[\d.]+)$`)
+)
+
+// ParseLogLine turns a line of either WifiLogger format back into an event.
+// The text format only keeps whole seconds and two decimals of latency, so
+// the event is less precise than what was logged.
+func ParseLogLine(line string) (LogEvent, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line)
+	}
+
+	match := textLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return LogEvent{}, ErrUnrecognizedLine
+	}
+	timestamp, err := time.Parse(time.RFC3339, match[1])
+	if err != nil {
+		return LogEvent{}, fmt.Errorf("invalid timestamp %q: %w", match[1], err)
+	}
+
+	event := LogEvent{Device: match[2], Timestamp: timestamp}
+	rest := match[3]
+	// the numbers are validated by the patterns, parse errors can't happen
+	number := func(s string) float64 {
+		value, _ := strconv.ParseFloat(s, 64)
+		return value
+	}
+
+	switch {
+	case checkSuccessPattern.MatchString(rest):
+		m := checkSuccessPattern.FindStringSubmatch(rest)
+		success := true
+		event.Type = EventConnectivityCheck
+		event.Success = &success
+		event.Latency = number(m[1]) * 1000
+
+	case checkFailurePattern.MatchString(rest):
+		m := checkFailurePattern.FindStringSubmatch(rest)
+		success := false
+		event.Type = EventConnectivityCheck
+		event.Success = &success
+		event.Latency = number(m[1]) * 1000
+		if m[2] != "<nil>" {
+			event.Error = m[2]
+		}
+
+	case statusChangePattern.MatchString(rest):
+		m := statusChangePattern.FindStringSubmatch(rest)
+		event.Type = EventStatusChange
+		event.From, event.To = m[1], m[2]
+
+	case rest == "OUTAGE START":
+		event.Type = EventOutageStart
+
+	case outageEndPattern.MatchString(rest):
+		m := outageEndPattern.FindStringSubmatch(rest)
+		event.Type = EventOutageEnd
+		event.Duration = number(m[1]) * 1000
+
+	case probeStatsPattern.MatchString(rest):
+		m := probeStatsPattern.FindStringSubmatch(rest)
+		event.Type = EventProbeStats
+		event.Target = m[1]
+		sent, _ := strconv.Atoi(m[2])
+		received, _ := strconv.Atoi(m[3])
+		event.Stats = &LogEventStats{
+			Sent:     sent,
+			Received: received,
+			Loss:     number(m[4]),
+			Min:      number(m[5]),
+			Avg:      number(m[6]),
+			Max:      number(m[7]),
+			Jitter:   number(m[8]),
+		}
+
+	case flapPattern.MatchString(rest):
+		m := flapPattern.FindStringSubmatch(rest)
+		start, err := time.Parse(time.RFC3339, m[1])
+		if err != nil {
+			return LogEvent{}, fmt.Errorf("invalid flap start %q: %w", m[1], err)
+		}
+		transitions, _ := strconv.Atoi(m[2])
+		event.Type = EventFlapIncident
+		event.Start = &start
+		event.Transitions = transitions
+
+	case anomalyPattern.MatchString(rest):
+		m := anomalyPattern.FindStringSubmatch(rest)
+		event.Type = EventLatencyAnomaly
+		event.Latency = number(m[1])
+		event.Expected = number(m[2])
+		event.P95 = number(m[3])
+		event.ExpectedP95 = number(m[4])
+		event.Score = number(m[5])
+
+	default:
+		return LogEvent{}, ErrUnrecognizedLine
+	}
+
+	return event, nil
+}
+
+func parseJSONLine(line string) (LogEvent, error) {
+	var event LogEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return LogEvent{}, fmt.Errorf("invalid json line: %w", err)
+	}
+
+	switch event.Type {
+	case EventConnectivityCheck:
+		if event.Success == nil {
+			return LogEvent{}, fmt.Errorf("%s event without success", event.Type)
+		}
+	case EventProbeStats:
+		if event.Stats == nil {
+			return LogEvent{}, fmt.Errorf("%s event without stats", event.Type)
+		}
+	case EventFlapIncident:
+		if event.Start == nil {
+			return LogEvent{}, fmt.Errorf("%s event without start", event.Type)
+		}
+	case EventStatusChange, EventOutageStart, EventOutageEnd, EventLatencyAnomaly:
+	default:
+		return LogEvent{}, fmt.Errorf("%w: unknown event type %q", ErrUnrecognizedLine, event.Type)
+	}
+	if event.Timestamp.IsZero() {
+		return LogEvent{}, fmt.Errorf("%s event without timestamp", event.Type)
+	}
+	return event, nil
+}
+
+// millis converts the millisecond floats of a LogEvent back to a duration.
+func millis(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Replay writes the event to storage as the monitor would have.
+func (e LogEvent) Replay(storage StorageWriter) error {
+	switch e.Type {
+	case EventConnectivityCheck:
+		var err error
+		if e.Error != "" {
+			err = errors.New(e.Error)
+		}
+		return storage.LogConnectivityCheck(e.Device, e.Success != nil && *e.Success, millis(e.Latency), e.Timestamp, err)
+
+	case EventStatusChange:
+		from, ok := ParseConnectionStatus(e.From)
+		if !ok {
+			return fmt.Errorf("unknown status %q", e.From)
+		}
+		to, ok := ParseConnectionStatus(e.To)
+		if !ok {
+			return fmt.Errorf("unknown status %q", e.To)
+		}
+		return storage.LogStatusChange(e.Device, from, to, e.Timestamp)
+
+	case EventOutageStart:
+		return storage.LogOutageStart(e.Device, e.Timestamp)
+
+	case EventOutageEnd:
+		return storage.LogOutageEnd(e.Device, millis(e.Duration), e.Timestamp)
+
+	case EventProbeStats:
+		return storage.LogProbeStats(e.Device, e.Target, ProbeStats{
+			Sent:     e.Stats.Sent,
+			Received: e.Stats.Received,
+			Loss:     e.Stats.Loss,
+			Min:      millis(e.Stats.Min),
+			Avg:      millis(e.Stats.Avg),
+			Max:      millis(e.Stats.Max),
+			Jitter:   millis(e.Stats.Jitter),
+		}, e.Timestamp)
+
+	case EventFlapIncident:
+		return storage.LogFlapIncident(e.Device, *e.Start, e.Timestamp, e.Transitions)
+
+	case EventLatencyAnomaly:
+		// storage without anomalies still has the status change
+		writer, ok := storage.(AnomalyWriter)
+		if !ok {
+			return nil
+		}
+		return writer.LogLatencyAnomaly(e.Device, LatencyAnomaly{
+			At:          e.Timestamp,
+			Latency:     millis(e.Latency),
+			Expected:    millis(e.Expected),
+			P95:         millis(e.P95),
+			ExpectedP95: millis(e.ExpectedP95),
+			Score:       e.Score,
+		})
+	}
+
+	return fmt.Errorf("%w: unknown event type %q", ErrUnrecognizedLine, e.Type)
+}
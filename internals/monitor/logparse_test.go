@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	stats := ProbeStats{Sent: 3, Received: 2, Loss: 33.3, Min: 10 * time.Millisecond, Avg: 15 * time.Millisecond, Max: 20 * time.Millisecond, Jitter: 2 * time.Millisecond}
+
+	for name, format := range map[string]LogFormat{"Text": FormatText, "JSON": FormatJSON} {
+		t.Run("RoundTrip"+name, func(t *testing.T) {
+			logFile := filepath.Join(t.TempDir(), "test.log")
+			myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{Format: format})
+			if err != nil {
+				t.Fatalf("Failed to create logger: %v", err)
+			}
+
+			myLogger.LogConnectivityCheck("dev", true, 120*time.Millisecond, now, nil)
+			myLogger.LogConnectivityCheck("dev", false, 2*time.Second, now, errors.New("i/o timeout"))
+			myLogger.LogStatusChange("dev", Running, Down, now)
+			myLogger.LogOutageStart("dev", now)
+			myLogger.LogOutageEnd("dev", 30*time.Second, now)
+			myLogger.LogProbeStats("dev", "1.1.1.1", stats, now)
+			myLogger.LogFlapIncident("dev", now.Add(-time.Minute), now, 6)
+			myLogger.LogLatencyAnomaly("dev", LatencyAnomaly{At: now, Latency: 250 * time.Millisecond, Expected: 40 * time.Millisecond, P95: 300 * time.Millisecond, ExpectedP95: 60 * time.Millisecond, Score: 12.5})
+			myLogger.Close()
+
+			content, _ := os.ReadFile(logFile)
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			events := make([]LogEvent, len(lines))
+			for i, line := range lines {
+				if events[i], err = ParseLogLine(line); err != nil {
+					t.Fatalf("Failed to parse %q: %v", line, err)
+				}
+				if events[i].Device != "dev" || !events[i].Timestamp.Equal(now) {
+					t.Errorf("Expected dev at %v, got %s at %v", now, events[i].Device, events[i].Timestamp)
+				}
+			}
+
+			if !*events[0].Success || events[0].Latency != 120 {
+				t.Errorf("Expected a 120ms success, got %+v", events[0])
+			}
+			if *events[1].Success || events[1].Error != "i/o timeout" {
+				t.Errorf("Expected a failure with its error, got %+v", events[1])
+			}
+			if events[2].From != "RUNNING" || events[2].To != "DOWN" {
+				t.Errorf("Expected RUNNING -> DOWN, got %+v", events[2])
+			}
+			if events[3].Type != EventOutageStart || events[4].Duration != 30000 {
+				t.Errorf("Expected an outage of 30s, got %+v %+v", events[3], events[4])
+			}
+			if events[5].Target != "1.1.1.1" || events[5].Stats.Received != 2 || events[5].Stats.Avg != 15 {
+				t.Errorf("Expected probe stats of 1.1.1.1, got %+v", events[5].Stats)
+			}
+			if events[6].Transitions != 6 || !events[6].Start.Equal(now.Add(-time.Minute)) {
+				t.Errorf("Expected a flap of 6 transitions, got %+v", events[6])
+			}
+			if events[7].Type != EventLatencyAnomaly || events[7].Latency != 250 || events[7].ExpectedP95 != 60 || events[7].Score != 12.5 {
+				t.Errorf("Expected a latency anomaly, got %+v", events[7])
+			}
+		})
+	}
+
+	t.Run("Unrecognized", func(t *testing.T) {
+		for _, line := range []string{
+			"",
+			"starting server",
+			"[2024-03-01T10:00:00Z] DEVICE: dev DID SOMETHING NEW",
+			`{"type":"reboot","device":"dev","timestamp":"2024-03-01T10:00:00Z"}`,
+		} {
+			if _, err := ParseLogLine(line); !errors.Is(err, ErrUnrecognizedLine) {
+				t.Errorf("Expected ErrUnrecognizedLine for %q, got %v", line, err)
+			}
+		}
+		if _, err := ParseLogLine("[yesterday] DEVICE: dev OUTAGE START"); err == nil {
+			t.Error("Expected an error for a bad timestamp")
+		}
+	})
+}
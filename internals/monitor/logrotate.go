@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RotationOptions controls rotation of the log file. Rotated files are
+// renamed to the log file name plus the rotation time, e.g.
+// log.txt.20240301T101500.000, and gzipped if Compress is set.
+type RotationOptions struct {
+	// MaxSize rotates before a write would grow the file past this many
+	// bytes, 0 disables size based rotation.
+	MaxSize int64
+	// MaxAge rotates once the file has been written to for this long. The
+	// age of a file left by an earlier run counts from its first line, so
+	// restarts don't keep it from rotating.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, 0 keeps all of them.
+	MaxBackups int
+	Compress   bool
+}
+
+const rotatedTimeFormat = "20060102T150405.000"
+
+func (f *WifiLogger) shouldRotate(next int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+int64(next) > f.rotation.MaxSize {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && f.now().Sub(f.openedAt) >= f.rotation.MaxAge
+}
+
+// firstLineTime is the timestamp of the first line of the log, false when
+// it can't be read or parsed.
+func firstLineTime(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(io.LimitReader(file, 64<<10)).ReadString('\n')
+	if err != nil && line == "" {
+		return time.Time{}, false
+	}
+	event, err := ParseLogLine(line)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return event.Timestamp, true
+}
+
+// rotate closes the current file and moves it aside, the caller holds the
+// lock and opens a new file afterwards.
+func (f *WifiLogger) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file for rotation: %w", err)
+	}
+	f.file = nil
+
+	rotated := f.logFile + "." + f.now().UTC().Format(rotatedTimeFormat)
+	if _, err := os.Stat(rotated); err == nil {
+		// two rotations in the same millisecond
+		rotated += fmt.Sprintf(".%d", time.Now().UnixNano())
+	}
+	if err := os.Rename(f.logFile, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	f.background.Add(1)
+	go func() {
+		defer f.background.Done()
+		f.rotateMu.Lock()
+		defer f.rotateMu.Unlock()
+
+		if err := f.cleanupRotated(); err != nil {
+			log.Println("failed to clean up rotated logs:", err)
+		}
+	}()
+	return nil
+}
+
+// cleanupRotated compresses every rotated file that isn't yet, including
+// ones left behind by a previous run, then removes the oldest beyond
+// MaxBackups.
+func (f *WifiLogger) cleanupRotated() error {
+	rotated, err := f.RotatedLogs()
+	if err != nil {
+		return err
+	}
+
+	if f.rotation.Compress {
+		for i, path := range rotated {
+			if strings.HasSuffix(path, ".gz") {
+				continue
+			}
+			if err := compressFile(path); err != nil {
+				return fmt.Errorf("failed to compress %s: %w", path, err)
+			}
+			rotated[i] = path + ".gz"
+		}
+	}
+
+	if f.rotation.MaxBackups <= 0 {
+		return nil
+	}
+	for len(rotated) > f.rotation.MaxBackups {
+		if err := os.Remove(rotated[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// compressFile gzips path into path.gz and removes the original.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// written under a temporary name so a half written archive is never
+	// mistaken for a rotated log
+	tmp := path + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// RotatedLogs lists the rotated files of the log, oldest first.
+func (f *WifiLogger) RotatedLogs() ([]string, error) {
+	matches, err := filepath.Glob(f.logFile + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := matches[:0]
+	for _, match := range matches {
+		if isRotatedSuffix(strings.TrimPrefix(match, f.logFile+".")) {
+			rotated = append(rotated, match)
+		}
+	}
+	// the timestamp sorts by name
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// isRotatedSuffix reports whether what follows "<log>." was written by
+// rotate: the timestamp, a collision counter if there was one, and .gz once
+// compressed. Anything else next to the log, a .bak or a half written .tmp,
+// is left alone.
+func isRotatedSuffix(suffix string) bool {
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	if len(suffix) < len(rotatedTimeFormat) {
+		return false
+	}
+	stamp, rest := suffix[:len(rotatedTimeFormat)], suffix[len(rotatedTimeFormat):]
+	if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+		return false
+	}
+	if rest == "" {
+		return true
+	}
+	counter, ok := strings.CutPrefix(rest, ".")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseInt(counter, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogRotation(t *testing.T) {
+	t.Run("SizeWithBackupsAndCompression", func(t *testing.T) {
+		logFile := filepath.Join(t.TempDir(), "test.log")
+		myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{Rotation: RotationOptions{
+			MaxSize:    200,
+			MaxBackups: 2,
+			Compress:   true,
+		}})
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+
+		// distinct rotation names without sleeping
+		now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		myLogger.now = func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}
+
+		for i := 0; i < 20; i++ {
+			if err := myLogger.LogOutageStart("device", now); err != nil {
+				t.Fatalf("Failed to log: %v", err)
+			}
+		}
+		if err := myLogger.Close(); err != nil {
+			t.Fatalf("Failed to close logger: %v", err)
+		}
+
+		info, err := os.Stat(logFile)
+		if err != nil {
+			t.Fatalf("Expected the current log to exist: %v", err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("Expected the current log to stay under 200 bytes, got %d", info.Size())
+		}
+
+		rotated, err := myLogger.RotatedLogs()
+		if err != nil {
+			t.Fatalf("Failed to list rotated logs: %v", err)
+		}
+		if len(rotated) != 2 {
+			t.Fatalf("Expected 2 rotated logs, got %v", rotated)
+		}
+		for _, path := range rotated {
+			if !strings.HasSuffix(path, ".gz") {
+				t.Errorf("Expected %s to be compressed", path)
+				continue
+			}
+			file, _ := os.Open(path)
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", path, err)
+			}
+			content, _ := io.ReadAll(gz)
+			file.Close()
+			if !strings.Contains(string(content), "OUTAGE START") {
+				t.Errorf("Expected log lines in %s, got %q", path, content)
+			}
+		}
+	})
+
+	t.Run("Age", func(t *testing.T) {
+		logFile := filepath.Join(t.TempDir(), "test.log")
+		myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{Rotation: RotationOptions{MaxAge: time.Hour}})
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		defer myLogger.Close()
+
+		now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		myLogger.now = func() time.Time { return now }
+
+		myLogger.LogOutageStart("device", now)
+		now = now.Add(30 * time.Minute)
+		myLogger.LogOutageEnd("device", time.Minute, now)
+		if rotated, _ := myLogger.RotatedLogs(); len(rotated) != 0 {
+			t.Fatalf("Expected no rotation within the hour, got %v", rotated)
+		}
+
+		now = now.Add(time.Hour)
+		myLogger.LogOutageStart("device", now)
+		rotated, _ := myLogger.RotatedLogs()
+		if len(rotated) != 1 {
+			t.Fatalf("Expected 1 rotated log after an hour, got %v", rotated)
+		}
+		content, _ := os.ReadFile(rotated[0])
+		if strings.Count(string(content), "\n") != 2 {
+			t.Errorf("Expected the first 2 lines in the rotated log, got %q", content)
+		}
+	})
+
+	t.Run("AgeSurvivesRestart", func(t *testing.T) {
+		logFile := filepath.Join(t.TempDir(), "test.log")
+		start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+		// every run writes a line 40 minutes after the last one and stops
+		for run := 0; run < 3; run++ {
+			myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{Rotation: RotationOptions{MaxAge: time.Hour}})
+			if err != nil {
+				t.Fatalf("Failed to create logger: %v", err)
+			}
+			now := start.Add(time.Duration(run) * 40 * time.Minute)
+			myLogger.now = func() time.Time { return now }
+			myLogger.LogOutageStart("device", now)
+			myLogger.Close()
+		}
+
+		myLogger, _ := NewWifiLoggerWithOptions(logFile, LoggerOptions{})
+		rotated, _ := myLogger.RotatedLogs()
+		if len(rotated) != 1 {
+			t.Fatalf("Expected the log to rotate once it was an hour old across restarts, got %v", rotated)
+		}
+		content, _ := os.ReadFile(rotated[0])
+		if strings.Count(string(content), "\n") != 2 {
+			t.Errorf("Expected the first 2 runs in the rotated log, got %q", content)
+		}
+	})
+
+	t.Run("ConcurrentWrites", func(t *testing.T) {
+		logFile := filepath.Join(t.TempDir(), "test.log")
+		myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{Rotation: RotationOptions{MaxSize: 1000}})
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					myLogger.LogOutageStart("device", time.Now())
+				}
+			}()
+		}
+		wg.Wait()
+		myLogger.Close()
+
+		rotated, _ := myLogger.RotatedLogs()
+		lines := 0
+		for _, path := range append(rotated, logFile) {
+			content, _ := os.ReadFile(path)
+			lines += strings.Count(string(content), "OUTAGE START\n")
+		}
+		if lines != 200 {
+			t.Errorf("Expected all 200 lines across the rotated logs, got %d", lines)
+		}
+	})
+
+	t.Run("IgnoresUnrelatedFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		logFile := filepath.Join(dir, "log.txt")
+		myLogger, err := NewWifiLoggerWithOptions(logFile, LoggerOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		defer myLogger.Close()
+
+		for _, name := range []string{
+			"log.txt.20240301T101500.000",
+			"log.txt.20240301T101500.000.1709288100000000000",
+			"log.txt.20240301T111500.000.gz",
+			"log.txt.bak",
+			"log.txt.20240301T121500.000.gz.tmp",
+			"log.txt.old.gz",
+		} {
+			os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		}
+
+		rotated, err := myLogger.RotatedLogs()
+		if err != nil {
+			t.Fatalf("Failed to list rotated logs: %v", err)
+		}
+		if len(rotated) != 3 {
+			t.Errorf("Expected only the 3 rotated logs, got %v", rotated)
+		}
+	})
+}
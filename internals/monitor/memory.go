@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps everything in memory. It is meant for tests and for
+// running without a database, nothing survives a restart.
+type MemoryStorage struct {
+	mu sync.RWMutex
+
+	checks        []CheckRecord
+	statusChanges []StatusChangeRecord
+	outages       []OutageRecord
+	devices       map[string]DeviceInfo
+	nextOutageID  int64
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		devices:      make(map[string]DeviceInfo),
+		nextOutageID: 1,
+	}
+}
+
+func (m *MemoryStorage) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks = append(m.checks, CheckRecord{
+		DeviceID:     deviceID,
+		Success:      success,
+		ResponseTime: responseTime,
+		Timestamp:    timestamp,
+		Error:        errStr,
+	})
+	return nil
+}
+
+func (m *MemoryStorage) LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statusChanges = append(m.statusChanges, StatusChangeRecord{
+		DeviceID:  deviceID,
+		From:      from,
+		To:        to,
+		Timestamp: timestamp,
+	})
+	return nil
+}
+
+func (m *MemoryStorage) LogOutageStart(deviceID string, timestamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outages = append(m.outages, OutageRecord{
+		ID:       m.nextOutageID,
+		DeviceID: deviceID,
+		Start:    timestamp,
+	})
+	m.nextOutageID++
+	return nil
+}
+
+func (m *MemoryStorage) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outages {
+		if m.outages[i].DeviceID == deviceID && m.outages[i].Open() {
+			m.outages[i].End = timestamp
+			m.outages[i].Duration = duration
+		}
+	}
+	return nil
+}
+
+// probe stats and flap incidents are not queryable yet, so they are dropped
+func (m *MemoryStorage) LogProbeStats(deviceID string, target string, stats ProbeStats, timestamp time.Time) error {
+	return nil
+}
+
+func (m *MemoryStorage) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	return nil
+}
+
+func (m *MemoryStorage) RegisterDevice(device DeviceInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.devices[device.ID] = device
+	return nil
+}
+
+func (m *MemoryStorage) GetOpenOutage(deviceID string) (time.Time, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := len(m.outages) - 1; i >= 0; i-- {
+		if m.outages[i].DeviceID == deviceID && m.outages[i].Open() {
+			return m.outages[i].Start, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+func (m *MemoryStorage) GetLastCheck(deviceID string) (time.Time, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var last time.Time
+	found := false
+	for _, check := range m.checks {
+		if check.DeviceID == deviceID && (!found || check.Timestamp.After(last)) {
+			last, found = check.Timestamp, true
+		}
+	}
+	return last, found, nil
+}
+
+func (m *MemoryStorage) MarkOutageInterrupted(deviceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outages {
+		if m.outages[i].DeviceID == deviceID && m.outages[i].Open() {
+			m.outages[i].Interrupted = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetChecks(deviceID string, from, to time.Time) ([]CheckRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []CheckRecord{}
+	for _, check := range m.checks {
+		if matchesDevice(deviceID, check.DeviceID) && inRange(check.Timestamp, from, to) {
+			result = append(result, check)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+func (m *MemoryStorage) GetStatusChanges(deviceID string, from, to time.Time) ([]StatusChangeRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []StatusChangeRecord{}
+	for _, change := range m.statusChanges {
+		if matchesDevice(deviceID, change.DeviceID) && inRange(change.Timestamp, from, to) {
+			result = append(result, change)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+func (m *MemoryStorage) GetOutages(query OutageQuery) ([]OutageRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	result := []OutageRecord{}
+	for _, outage := range m.outages {
+		if query.matches(outage, now) {
+			result = append(result, outage)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if query.Descending {
+			return result[i].Start.After(result[j].Start)
+		}
+		return result[i].Start.Before(result[j].Start)
+	})
+
+	if query.Offset > 0 {
+		result = result[min(query.Offset, len(result)):]
+	}
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) GetDeviceStats(deviceID string, from, to time.Time) (DeviceStats, error) {
+	checks, _ := m.GetChecks(deviceID, from, to)
+	outages, _ := m.GetOutages(OutageQuery{DeviceIDs: deviceIDs(deviceID), From: from, To: to})
+	return ComputeDeviceStats(deviceID, from, to, checks, outages), nil
+}
+
+func (m *MemoryStorage) GetDevices() ([]DeviceInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]DeviceInfo, 0, len(m.devices))
+	for _, device := range m.devices {
+		result = append(result, device)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DisplayName() < result[j].DisplayName() })
+	return result, nil
+}
+
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// deviceIDs turns the single device convention of the reader, where empty
+// means all, into a query filter.
+func deviceIDs(deviceID string) []string {
+	if deviceID == "" {
+		return nil
+	}
+	return []string{deviceID}
+}
+
+func matchesDevice(want, got string) bool {
+	return want == "" || want == got
+}
+
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	storage.LogConnectivityCheck("a", true, 20*time.Millisecond, base, nil)
+	storage.LogConnectivityCheck("a", true, 40*time.Millisecond, base.Add(time.Minute), nil)
+	storage.LogConnectivityCheck("a", false, time.Second, base.Add(2*time.Minute), errors.New("timeout"))
+	storage.LogConnectivityCheck("b", true, time.Millisecond, base, nil)
+
+	storage.LogStatusChange("a", Running, Down, base.Add(2*time.Minute))
+
+	// one outage that started before the window, one still open
+	storage.LogOutageStart("a", base.Add(-30*time.Minute))
+	storage.LogOutageEnd("a", 40*time.Minute, base.Add(10*time.Minute))
+	storage.LogOutageStart("a", base.Add(50*time.Minute))
+
+	from, to := base, base.Add(time.Hour)
+
+	checks, err := storage.GetChecks("a", from, to)
+	if err != nil || len(checks) != 3 {
+		t.Fatalf("Expected 3 checks for a, got %d (err=%v)", len(checks), err)
+	}
+	all, _ := storage.GetChecks("", from, to)
+	if len(all) != 4 {
+		t.Errorf("Expected 4 checks across devices, got: %d", len(all))
+	}
+
+	changes, _ := storage.GetStatusChanges("a", from, to)
+	if len(changes) != 1 || changes[0].To != Down {
+		t.Errorf("Unexpected status changes: %+v", changes)
+	}
+
+	outages, _ := storage.GetOutages(OutageQuery{DeviceIDs: []string{"a"}, From: from, To: to})
+	if len(outages) != 2 || outages[0].Open() || !outages[1].Open() {
+		t.Fatalf("Expected a closed and an open outage, got: %+v", outages)
+	}
+
+	stats, err := storage.GetDeviceStats("a", from, to)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Checks != 3 || stats.FailedChecks != 1 || stats.AverageLatency != 30*time.Millisecond {
+		t.Errorf("Unexpected check stats: %+v", stats)
+	}
+	// 10 minutes of the first outage and 10 of the open one fall in the window
+	if stats.Outages != 2 || stats.TotalDowntime != 20*time.Minute {
+		t.Errorf("Unexpected outage stats: %+v", stats)
+	}
+}
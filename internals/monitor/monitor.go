@@ -2,27 +2,21 @@ package monitor
 
 import (
 	"WifiTracker/internals/alerts"
+	"WifiTracker/util"
+	"context"
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"os/signal"
-	"runtime"
+	"log"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-var ErrConnectionDown = errors.New("connection is down")
-
-type StorageProvider interface {
-	LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error
-	LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error
-	LogOutageStart(deviceID string, timestamp time.Time) error
-	LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error
-}
+var (
+	ErrConnectionDown = errors.New("connection is down")
+	ErrAlreadyRunning = errors.New("monitor is already running")
+)
 
 type ConnectivityEvent struct {
 	DeviceID  string
@@ -34,24 +28,66 @@ type ConnectivityEvent struct {
 
 type WifiMonitor struct {
 	DeviceID      string
+	device        DeviceInfo
 	checkInterval time.Duration
 
-	storage StorageProvider
+	storage      StorageWriter
+	targets      []Target
+	quorum       Quorum
+	thresholds   Thresholds
+	hysteresis   Hysteresis
+	clock        Clock
+	resumeWindow time.Duration
+
+	onStorageError func(error)
+	notifiers      []alerts.Notifier
+	notifications  alerts.DispatcherConfig
+	probeTimeout   time.Duration
+	tickTimeout    time.Duration
+	burstSize      int
+	burstInterval  time.Duration
 
 	isRunning  bool
+	cancel     context.CancelFunc
+	done       chan struct{}
 	lastStatus ConnectionStatus
-
-	averageLatency float32
-	pingCount      float32
+	lastTick   TickResult
+	// dispatcher lives for one run of Start
+	dispatcher *alerts.Dispatcher
+	// the targets that stopped answering when the current outage began
+	outageTargets []string
+	// targets whose last logged probe stats were degraded, only touched by
+	// the goroutine running Start
+	degradedTargets map[string]bool
+
+	latency  *latencyTracker
+	anomaly  AnomalyConfig
+	history  StorageReader
+	baseline *latencyBaseline
+	// the minute being watched for the baseline, learned once it is over
+	// unless it was anomalous
+	baselineMinute  time.Time
+	minuteAnomalous bool
 
 	DataLock sync.RWMutex
 
 	simulateOutage bool
 }
 
+// DeviceData is what the dashboard shows of a monitor. Latency is the
+// EWMA, the window latencies are averages over the last 1m, 5m and 1h.
 type DeviceData struct {
-	Online  string
-	Latency string
+	DeviceID   string
+	Name       string
+	Online     string
+	Latency    string
+	Latency1m  string
+	Latency5m  string
+	Latency1h  string
+	MinLatency string
+	MaxLatency string
+	Jitter     string
+	PacketLoss string
 }
 
 var (
@@ -59,16 +95,52 @@ var (
 	devicesMutex sync.RWMutex
 )
 
-func New(checkInterval time.Duration, storage StorageProvider) *WifiMonitor {
+func New(checkInterval time.Duration, storage StorageWriter) *WifiMonitor {
+	config := DefaultConfig()
+	config.CheckInterval = checkInterval
+	return newMonitor(config, storage)
+}
+
+// NewWithConfig creates a monitor with custom targets and quorum rules.
+func NewWithConfig(config Config, storage StorageWriter) (*WifiMonitor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid monitor config: %w", err)
+	}
+	return newMonitor(config, storage), nil
+}
+
+func newMonitor(config Config, storage StorageWriter) *WifiMonitor {
+	device := config.Device
+	if device.ID == "" {
+		device.ID = uuid.NewString()
+	}
+
 	monitor := &WifiMonitor{
-		DeviceID:       uuid.NewString(),
-		checkInterval:  checkInterval,
-		storage:        storage,
-		isRunning:      false,
-		lastStatus:     Inactive,
-		simulateOutage: false,
-		averageLatency: 0,
-		pingCount:      0,
+		DeviceID:        device.ID,
+		device:          device,
+		checkInterval:   config.CheckInterval,
+		storage:         storage,
+		targets:         config.Targets,
+		quorum:          config.Quorum,
+		thresholds:      config.Thresholds,
+		hysteresis:      config.Hysteresis,
+		clock:           config.Clock,
+		resumeWindow:    config.ResumeWindow,
+		onStorageError:  config.OnStorageError,
+		notifiers:       config.Notifiers,
+		notifications:   config.Notifications,
+		probeTimeout:    config.ProbeTimeout,
+		tickTimeout:     config.TickTimeout,
+		burstSize:       config.BurstSize,
+		burstInterval:   config.BurstInterval,
+		isRunning:       false,
+		lastStatus:      Inactive,
+		simulateOutage:  false,
+		latency:         newLatencyTracker(config.LatencyHalfLife),
+		degradedTargets: map[string]bool{},
+		anomaly:         config.Anomaly,
+		history:         config.History,
+		baseline:        newLatencyBaseline(config.Anomaly.Location),
 	}
 
 	devicesMutex.Lock()
@@ -78,139 +150,342 @@ func New(checkInterval time.Duration, storage StorageProvider) *WifiMonitor {
 	return monitor
 }
 
-func (w *WifiMonitor) Start() {
-	ticker := time.NewTicker(w.checkInterval)
-	defer ticker.Stop()
-
+// Start runs the monitor until ctx is cancelled or Stop is called. On the
+// way out it closes any open outage, flushes storage and marks the device
+// Inactive.
+func (w *WifiMonitor) Start(ctx context.Context) error {
 	w.DataLock.Lock()
-	w.lastStatus = Running
+	if w.isRunning {
+		w.DataLock.Unlock()
+		return ErrAlreadyRunning
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w.cancel = cancel
+	w.done = make(chan struct{})
 	w.isRunning = true
 	w.DataLock.Unlock()
 
-	w.logStatusChange(Inactive, Running, time.Now())
+	defer close(w.done)
+	defer cancel()
+
+	w.dispatcher = alerts.NewDispatcher(w.notifications, w.notifiers...)
+	defer w.closeDispatcher()
+
+	if registry, ok := w.storage.(DeviceRegistry); ok {
+		w.storageError("register device", registry.RegisterDevice(w.device))
+	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	machine := NewStateMachine(w.thresholds, w.hysteresis, w.clock)
+	w.recoverOutage(machine)
+	w.learnBaseline()
 
-	failCount, outageStart := 0, false
-	var outageStartTime time.Time
+	status := machine.Status()
+	w.DataLock.Lock()
+	w.lastStatus = status
+	w.DataLock.Unlock()
+	w.logStatusChange(Inactive, status, w.clock.Now())
+
+	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			down, avgResponse := w.isConnectionDown()
-
-			w.DataLock.Lock()
-			w.pingCount++
-			w.averageLatency = (w.averageLatency*(w.pingCount-1) + float32(avgResponse.Milliseconds())) / w.pingCount
-			w.DataLock.Unlock()
-
-			if down {
-				fmt.Printf("Response time: %f seconds\n", avgResponse.Seconds())
-				w.logConnectivityCheck(false, avgResponse, ErrConnectionDown)
-				failCount++
-
-				if failCount >= 3 {
-					if !outageStart {
-						outageStartTime = time.Now()
-						outageStart = true
-
-						w.DataLock.Lock()
-						if w.lastStatus != Down {
-							w.logStatusChange(w.lastStatus, Down, time.Now())
-							w.lastStatus = Down
-						}
-						w.DataLock.Unlock()
-
-						w.logOutageStart(time.Now())
-					}
-				}
-			} else {
-				failCount = 0
-				if outageStart {
-					totalDuration := time.Since(outageStartTime)
-					w.logOutageEnd(totalDuration, time.Now())
-					alerts.SendOutageAlert(totalDuration)
-					outageStart = false
-				}
-
-				w.logConnectivityCheck(true, avgResponse, nil)
-
-				newStatus := Running
-				if avgResponse.Seconds() > 3.0 {
-					newStatus = Slow
-				}
-
-				w.DataLock.Lock()
-				if w.lastStatus != newStatus {
-					w.logStatusChange(w.lastStatus, newStatus, time.Now())
-					w.lastStatus = newStatus
-				}
-				w.DataLock.Unlock()
+			tick := w.probeTargets(ctx)
+			// probes cut short by shutdown say nothing about the connection
+			if ctx.Err() != nil {
+				continue
 			}
+			tick.Anomaly = w.observeLatency(tick)
+			w.applyTick(tick, machine.Observe(tick))
 
-		case <-sigChan:
-			fmt.Println("\nMonitoring stopped by user")
-			w.DataLock.Lock()
-			w.isRunning = false
-			w.lastStatus = Inactive
-			w.DataLock.Unlock()
-			return
+		case <-ctx.Done():
+			return w.shutdown(machine)
 		}
 	}
 }
 
-func (w *WifiMonitor) GetStatus() ConnectionStatus {
+// recoverOutage picks up an outage left open by a previous run. If the
+// tracker was only briefly away the outage carries on, otherwise it is
+// closed at the last check we know of. Either way it is flagged as
+// interrupted since we did not watch all of it.
+func (w *WifiMonitor) recoverOutage(machine *StateMachine) {
+	recovery, ok := w.storage.(OutageRecovery)
+	if !ok {
+		return
+	}
+
+	outageStart, open, err := recovery.GetOpenOutage(w.DeviceID)
+	if err != nil {
+		w.storageError("look up open outage", err)
+		return
+	}
+	if !open {
+		return
+	}
+
+	w.storageError("mark outage interrupted", recovery.MarkOutageInterrupted(w.DeviceID))
+
+	lastSeen, found, err := recovery.GetLastCheck(w.DeviceID)
+	w.storageError("look up last check", err)
+	if !found || lastSeen.Before(outageStart) {
+		lastSeen = outageStart
+	}
+
+	if w.clock.Now().Sub(lastSeen) <= w.resumeWindow {
+		machine.ResumeOutage(outageStart)
+		return
+	}
+
+	w.logOutageEnd(lastSeen.Sub(outageStart), lastSeen)
+}
+
+// learnBaseline reads the latency history of the device, if there is one.
+func (w *WifiMonitor) learnBaseline() {
+	if w.history == nil || w.anomaly.Disabled {
+		return
+	}
+	now := w.clock.Now()
+	w.storageError("learn latency baseline", w.baseline.learn(w.history, w.DeviceID, now.Add(-w.anomaly.History), now))
+}
+
+// observeLatency records the latency of a tick and checks the last minute
+// against the baseline. Every minute that passes without an anomaly is
+// learned into the baseline.
+func (w *WifiMonitor) observeLatency(tick TickResult) *LatencyAnomaly {
+	now := w.clock.Now()
+
+	w.DataLock.Lock()
+	defer w.DataLock.Unlock()
+
+	if minute := now.Truncate(time.Minute); !minute.Equal(w.baselineMinute) {
+		last := w.latency.window(now, time.Minute)
+		if !w.baselineMinute.IsZero() && !w.minuteAnomalous && last.Ticks > last.Failures {
+			w.baseline.add(w.baselineMinute, last.Avg, last.P95)
+		}
+		w.baselineMinute = minute
+		w.minuteAnomalous = false
+	}
+
+	w.latency.observe(now, tick.AverageLatency, !tick.Down)
+	if w.anomaly.Disabled || tick.Down {
+		return nil
+	}
+
+	anomaly := w.baseline.check(now, w.latency.window(now, time.Minute), w.anomaly)
+	if anomaly != nil {
+		w.minuteAnomalous = true
+	}
+	return anomaly
+}
+
+// Stop ends a running Start and waits for its shutdown to finish.
+func (w *WifiMonitor) Stop() {
 	w.DataLock.RLock()
-	defer w.DataLock.RUnlock()
-	return w.lastStatus
+	cancel, done := w.cancel, w.done
+	w.DataLock.RUnlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
 }
 
-func (w *WifiMonitor) GetAverageLatency() float32 {
+func (w *WifiMonitor) IsRunning() bool {
 	w.DataLock.RLock()
 	defer w.DataLock.RUnlock()
-	return w.averageLatency
+	return w.isRunning
+}
+
+func (w *WifiMonitor) shutdown(machine *StateMachine) error {
+	now := w.clock.Now()
+
+	if outageStart, ok := machine.OutageStart(); ok {
+		w.logOutageEnd(now.Sub(outageStart), now)
+	}
+
+	w.DataLock.Lock()
+	last := w.lastStatus
+	w.lastStatus = Inactive
+	w.isRunning = false
+	w.cancel = nil
+	w.DataLock.Unlock()
+	w.logStatusChange(last, Inactive, now)
+
+	if flusher, ok := w.storage.(Flusher); ok {
+		if err := flusher.Flush(); err != nil {
+			return fmt.Errorf("failed to flush storage: %w", err)
+		}
+	}
+	return nil
 }
 
-func (w *WifiMonitor) ping(target string) (bool, time.Duration) {
-	start := time.Now()
+// applyTick records a tick and writes out whatever the state machine
+// decided for it.
+func (w *WifiMonitor) applyTick(tick TickResult, transition Transition) {
+	avgResponse := tick.AverageLatency
+
+	w.logProbeStats(tick)
+	if tick.Down {
+		w.logConnectivityCheck(false, avgResponse, ErrConnectionDown)
+	} else {
+		w.logConnectivityCheck(true, avgResponse, nil)
+	}
+
+	w.DataLock.Lock()
+	w.lastTick = tick
+	w.lastStatus = transition.Status
+	w.DataLock.Unlock()
+
+	// written after unlocking, storage and its error handler may well read
+	// the monitor
+	for _, change := range transition.Changes {
+		w.logStatusChange(change.From, change.To, transition.At)
+	}
+
+	if transition.Flap != nil {
+		w.logFlapIncident(*transition.Flap)
+	}
+
+	if transition.OutageStarted {
+		w.outageTargets = tick.Failed()
+		w.logOutageStart(transition.At)
+	}
+	if transition.OutageEnded {
+		w.logOutageEnd(transition.OutageDuration, transition.At)
+	}
+	if transition.Anomaly != nil {
+		w.logLatencyAnomaly(*transition.Anomaly)
+	}
+	if transition.Alert {
+		w.notify(tick, transition)
+	}
+}
 
-	var cmd *exec.Cmd
+// closeDispatcher gives pending notifications a moment to go out.
+func (w *WifiMonitor) closeDispatcher() {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyShutdownTimeout)
+	defer cancel()
+	w.dispatcher.Close(ctx)
+}
 
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.Command("ping", "-n", "1", target)
-	case "darwin", "linux", "freebsd", "openbsd", "netbsd":
-		cmd = exec.Command("ping", "-c", "1", target)
+// notify hands the alert of a transition to the notifiers, they run in the
+// background so a slow one can't hold up the next tick.
+func (w *WifiMonitor) notify(tick TickResult, transition Transition) {
+	notification := alerts.Notification{DeviceID: w.DeviceID, Device: w.device.DisplayName()}
+	switch {
+	case transition.Flap != nil:
+		notification.Kind = alerts.KindFlapping
+		notification.Start = transition.Flap.Start
+		notification.End = transition.Flap.End
+		notification.Duration = transition.Flap.End.Sub(transition.Flap.Start)
+		notification.Transitions = transition.Flap.Transitions
+	case transition.OutageEnded:
+		notification.Kind = alerts.KindOutage
+		notification.Start = transition.At.Add(-transition.OutageDuration)
+		notification.End = transition.At
+		notification.Duration = transition.OutageDuration
+		notification.Targets = w.outageTargets
+	case transition.Anomaly != nil:
+		notification.Kind = alerts.KindLatencyAnomaly
+		notification.Start = transition.Anomaly.At
+		notification.Latency = transition.Anomaly.Latency
+		notification.Expected = transition.Anomaly.Expected
+		notification.Targets = tick.SlowerThan(transition.Anomaly.Expected)
 	default:
-		cmd = exec.Command("ping", "-c", "1", target)
+		return
 	}
-	err := cmd.Run()
-	responseTime := time.Since(start)
 
-	if err != nil {
-		return false, responseTime
+	if err := w.dispatcher.Send(notification); err != nil {
+		log.Printf("failed to notify for %s: %v", w.DeviceID, err)
 	}
+}
+
+func (w *WifiMonitor) GetDevice() DeviceInfo {
+	return w.device
+}
+
+func (w *WifiMonitor) GetStatus() ConnectionStatus {
+	w.DataLock.RLock()
+	defer w.DataLock.RUnlock()
+	return w.lastStatus
+}
+
+// GetLastTick returns the most recent round of probe results.
+func (w *WifiMonitor) GetLastTick() TickResult {
+	w.DataLock.RLock()
+	defer w.DataLock.RUnlock()
+	return w.lastTick
+}
 
-	return true, responseTime
+// GetLatencyStats returns the latency EWMA and the 1m, 5m and 1h windows.
+func (w *WifiMonitor) GetLatencyStats() LatencyStats {
+	w.DataLock.RLock()
+	defer w.DataLock.RUnlock()
+	return w.latency.stats(w.clock.Now())
+}
+
+// storageError surfaces a failed storage call instead of dropping it. Monitoring
+// carries on either way.
+func (w *WifiMonitor) storageError(op string, err error) {
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("failed to %s for %s: %w", op, w.DeviceID, err)
+	if w.onStorageError != nil {
+		w.onStorageError(err)
+		return
+	}
+	log.Println(err)
 }
 
 func (w *WifiMonitor) logConnectivityCheck(success bool, responseTime time.Duration, err error) {
-	w.storage.LogConnectivityCheck(w.DeviceID, success, responseTime, time.Now(), err)
+	w.storageError("log connectivity check", w.storage.LogConnectivityCheck(w.DeviceID, success, responseTime, w.clock.Now(), err))
+}
+
+// logProbeStats writes the stats of targets that failed or lost probes, and
+// the first clean ones after that. A healthy target adds nothing the
+// connectivity check doesn't already say.
+func (w *WifiMonitor) logProbeStats(tick TickResult) {
+	for _, result := range tick.Results {
+		degraded := !result.Success || result.Stats.Loss > 0
+		if !degraded && !w.degradedTargets[result.Name] {
+			continue
+		}
+		w.degradedTargets[result.Name] = degraded
+		w.storageError("log probe stats", w.storage.LogProbeStats(w.DeviceID, result.Name, result.Stats, tick.Started))
+	}
 }
 
 func (w *WifiMonitor) logStatusChange(from, to ConnectionStatus, timestamp time.Time) {
-	w.storage.LogStatusChange(w.DeviceID, from, to, timestamp)
+	w.storageError("log status change", w.storage.LogStatusChange(w.DeviceID, from, to, timestamp))
+}
+
+func (w *WifiMonitor) logFlapIncident(incident FlapIncident) {
+	w.storageError("log flap incident", w.storage.LogFlapIncident(w.DeviceID, incident.Start, incident.End, incident.Transitions))
 }
 
 func (w *WifiMonitor) logOutageStart(timestamp time.Time) {
-	w.storage.LogOutageStart(w.DeviceID, timestamp)
+	w.storageError("log outage start", w.storage.LogOutageStart(w.DeviceID, timestamp))
 }
 
 func (w *WifiMonitor) logOutageEnd(duration time.Duration, timestamp time.Time) {
-	w.storage.LogOutageEnd(w.DeviceID, duration, timestamp)
+	w.storageError("log outage end", w.storage.LogOutageEnd(w.DeviceID, duration, timestamp))
+}
+
+func (w *WifiMonitor) logLatencyAnomaly(anomaly LatencyAnomaly) {
+	if writer, ok := w.storage.(AnomalyWriter); ok {
+		w.storageError("log latency anomaly", writer.LogLatencyAnomaly(w.DeviceID, anomaly))
+	}
 }
 
+const (
+	defaultProbeTimeout    = 2 * time.Second
+	defaultLatencyHalfLife = time.Minute
+	notifyShutdownTimeout  = 5 * time.Second
+)
+
 var defaultTargets = []string{
 	"8.8.8.8",
 	"1.1.1.1",
@@ -218,24 +493,6 @@ var defaultTargets = []string{
 	"8.8.4.4",
 }
 
-func (w *WifiMonitor) isConnectionDown() (bool, time.Duration) {
-	failures := 0
-	totalDuration := time.Duration(0)
-
-	for _, target := range defaultTargets {
-		ok, duration := w.ping(target)
-		if !ok {
-			failures++
-		}
-		totalDuration += duration
-	}
-
-	avgDuration := totalDuration / time.Duration(len(defaultTargets))
-	isDown := failures >= 3
-
-	return isDown, avgDuration
-}
-
 func GetAllDeviceData() []DeviceData {
 	devicesMutex.RLock()
 	defer devicesMutex.RUnlock()
@@ -244,9 +501,20 @@ func GetAllDeviceData() []DeviceData {
 
 	for _, monitor := range AllDevices {
 		monitor.DataLock.RLock()
+		stats := monitor.lastTick.Stats
+		latency := monitor.latency.stats(monitor.clock.Now())
 		result = append(result, DeviceData{
-			Online:  monitor.lastStatus.String(),
-			Latency: fmt.Sprintf("%f", monitor.averageLatency),
+			DeviceID:   monitor.DeviceID,
+			Name:       monitor.device.DisplayName(),
+			Online:     monitor.lastStatus.String(),
+			Latency:    fmt.Sprintf("%f", util.DurationMs(latency.EWMA)),
+			Latency1m:  fmt.Sprintf("%f", util.DurationMs(latency.Windows[0].Avg)),
+			Latency5m:  fmt.Sprintf("%f", util.DurationMs(latency.Windows[1].Avg)),
+			Latency1h:  fmt.Sprintf("%f", util.DurationMs(latency.Windows[2].Avg)),
+			MinLatency: fmt.Sprintf("%f", util.DurationMs(stats.Min)),
+			MaxLatency: fmt.Sprintf("%f", util.DurationMs(stats.Max)),
+			Jitter:     fmt.Sprintf("%f", util.DurationMs(stats.Jitter)),
+			PacketLoss: fmt.Sprintf("%f", stats.Loss),
 		})
 		monitor.DataLock.RUnlock()
 	}
@@ -0,0 +1,285 @@
+package monitor
+
+import (
+	"WifiTracker/internals/alerts"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingStorage keeps every write in memory for assertions.
+type recordingStorage struct {
+	mu            sync.Mutex
+	statusChanges []StatusChange
+	outageStarts  int
+	outageEnds    int
+	flushed       bool
+	probeStats    []string
+}
+
+func (r *recordingStorage) LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error {
+	return nil
+}
+
+func (r *recordingStorage) LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusChanges = append(r.statusChanges, StatusChange{From: from, To: to})
+	return nil
+}
+
+func (r *recordingStorage) LogOutageStart(deviceID string, timestamp time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outageStarts++
+	return nil
+}
+
+func (r *recordingStorage) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outageEnds++
+	return nil
+}
+
+func (r *recordingStorage) LogProbeStats(deviceID string, target string, stats ProbeStats, timestamp time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.probeStats = append(r.probeStats, target)
+	return nil
+}
+
+func (r *recordingStorage) LogFlapIncident(deviceID string, start, end time.Time, transitions int) error {
+	return nil
+}
+
+func (r *recordingStorage) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushed = true
+	return nil
+}
+
+func TestMonitorLifecycle(t *testing.T) {
+	storage := &recordingStorage{}
+	config := Config{
+		CheckInterval: 10 * time.Millisecond,
+		Targets:       []Target{{Name: "down", Prober: &staticProber{}}},
+		Hysteresis:    Hysteresis{DefaultEnter: 1, DefaultExit: 1},
+	}
+	monitor, err := NewWithConfig(config, storage)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- monitor.Start(context.Background())
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for monitor.GetStatus() != Down {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected monitor to go down, status: %s", monitor.GetStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := monitor.Start(context.Background()); err != ErrAlreadyRunning {
+		t.Errorf("Expected second start to fail, got: %v", err)
+	}
+
+	monitor.Stop()
+	if err := <-errChan; err != nil {
+		t.Fatalf("Expected clean shutdown, got: %v", err)
+	}
+
+	if monitor.IsRunning() || monitor.GetStatus() != Inactive {
+		t.Errorf("Expected stopped monitor to be inactive, got: %s", monitor.GetStatus())
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if storage.outageStarts != 1 || storage.outageEnds != 1 {
+		t.Errorf("Expected open outage to be closed on shutdown, got %d starts and %d ends", storage.outageStarts, storage.outageEnds)
+	}
+	if last := storage.statusChanges[len(storage.statusChanges)-1]; last.To != Inactive {
+		t.Errorf("Expected last status change to inactive, got: %v", last)
+	}
+	if !storage.flushed {
+		t.Errorf("Expected storage to be flushed on shutdown")
+	}
+}
+
+// recoveringStorage pretends a previous run left an outage open.
+type recoveringStorage struct {
+	recordingStorage
+	outageStart time.Time
+	lastCheck   time.Time
+	interrupted bool
+	endDuration time.Duration
+}
+
+func (r *recoveringStorage) GetOpenOutage(deviceID string) (time.Time, bool, error) {
+	return r.outageStart, true, nil
+}
+
+func (r *recoveringStorage) GetLastCheck(deviceID string) (time.Time, bool, error) {
+	return r.lastCheck, true, nil
+}
+
+func (r *recoveringStorage) MarkOutageInterrupted(deviceID string) error {
+	r.interrupted = true
+	return nil
+}
+
+func (r *recoveringStorage) LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error {
+	r.endDuration = duration
+	return r.recordingStorage.LogOutageEnd(deviceID, duration, timestamp)
+}
+
+func TestMonitorRecoverOutage(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	newMonitor := func(storage StorageWriter) *WifiMonitor {
+		config := Config{
+			CheckInterval: time.Second,
+			Targets:       []Target{{Prober: &staticProber{}}},
+			Clock:         clock,
+			ResumeWindow:  time.Minute,
+		}
+		monitor, err := NewWithConfig(config, storage)
+		if err != nil {
+			t.Fatalf("Failed to create monitor: %v", err)
+		}
+		return monitor
+	}
+
+	t.Run("Resume", func(t *testing.T) {
+		storage := &recoveringStorage{
+			outageStart: clock.now.Add(-10 * time.Minute),
+			lastCheck:   clock.now.Add(-10 * time.Second),
+		}
+		monitor := newMonitor(storage)
+		machine := NewStateMachine(monitor.thresholds, monitor.hysteresis, clock)
+		monitor.recoverOutage(machine)
+
+		if start, ok := machine.OutageStart(); !ok || !start.Equal(storage.outageStart) {
+			t.Errorf("Expected outage to be resumed from %v, got: %v", storage.outageStart, start)
+		}
+		if machine.Status() != Down || storage.outageEnds != 0 || !storage.interrupted {
+			t.Errorf("Expected resumed outage to stay open and be flagged interrupted")
+		}
+	})
+
+	t.Run("CloseStale", func(t *testing.T) {
+		storage := &recoveringStorage{
+			outageStart: clock.now.Add(-2 * time.Hour),
+			lastCheck:   clock.now.Add(-time.Hour),
+		}
+		monitor := newMonitor(storage)
+		machine := NewStateMachine(monitor.thresholds, monitor.hysteresis, clock)
+		monitor.recoverOutage(machine)
+
+		if _, ok := machine.OutageStart(); ok {
+			t.Errorf("Expected stale outage not to be resumed")
+		}
+		if storage.outageEnds != 1 || storage.endDuration != time.Hour || !storage.interrupted {
+			t.Errorf("Expected stale outage closed at the last check, got duration %v", storage.endDuration)
+		}
+	})
+}
+
+// notifierFunc adapts a function to alerts.Notifier.
+type notifierFunc func(ctx context.Context, notification alerts.Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, notification alerts.Notification) error {
+	return f(ctx, notification)
+}
+
+func TestMonitorNotify(t *testing.T) {
+	received := make(chan alerts.Notification, 2)
+	config := Config{
+		Device:        DeviceInfo{ID: "dev", Name: "Laptop"},
+		CheckInterval: time.Second,
+		Targets:       []Target{{Name: "static", Prober: &staticProber{}}},
+		Notifiers: []alerts.Notifier{
+			notifierFunc(func(ctx context.Context, notification alerts.Notification) error {
+				panic("broken notifier")
+			}),
+			notifierFunc(func(ctx context.Context, notification alerts.Notification) error {
+				received <- notification
+				return nil
+			}),
+		},
+		Notifications: alerts.DispatcherConfig{Backoff: alerts.Backoff{Attempts: 1}, OnError: func(error) {}},
+	}
+	monitor, err := NewWithConfig(config, &recordingStorage{})
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	monitor.dispatcher = alerts.NewDispatcher(monitor.notifications, monitor.notifiers...)
+
+	end := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	monitor.applyTick(TickResult{Results: []ProbeResult{{Name: "static"}}, Down: true}, Transition{At: end.Add(-time.Minute), OutageStarted: true})
+	monitor.applyTick(TickResult{}, Transition{At: end, OutageEnded: true, OutageDuration: time.Minute, Alert: true})
+	slow := TickResult{Results: []ProbeResult{
+		{Name: "fast", Success: true, Latency: 15 * time.Millisecond},
+		{Name: "slow", Success: true, Latency: 300 * time.Millisecond},
+	}}
+	monitor.applyTick(slow, Transition{At: end, Alert: true, Anomaly: &LatencyAnomaly{At: end, Latency: 150 * time.Millisecond, Expected: 20 * time.Millisecond}})
+	monitor.dispatcher.Close(context.Background())
+
+	notifications := map[string]alerts.Notification{}
+	for len(received) > 0 {
+		notification := <-received
+		notifications[notification.Kind] = notification
+	}
+
+	outage, ok := notifications[alerts.KindOutage]
+	if !ok {
+		t.Fatal("Expected the working notifier to get the outage despite the panicking one")
+	}
+	if outage.Device != "Laptop" || !outage.Start.Equal(end.Add(-time.Minute)) || len(outage.Targets) != 1 {
+		t.Errorf("Unexpected notification %+v", outage)
+	}
+
+	anomaly, ok := notifications[alerts.KindLatencyAnomaly]
+	if !ok {
+		t.Fatal("Expected the anomaly to be notified")
+	}
+	if len(anomaly.Targets) != 1 || anomaly.Targets[0] != "slow" {
+		t.Errorf("Expected only the target slower than the baseline, got %v", anomaly.Targets)
+	}
+}
+
+func TestMonitorProbeStats(t *testing.T) {
+	storage := &recordingStorage{}
+	monitor, err := NewWithConfig(Config{
+		CheckInterval: time.Second,
+		Targets:       []Target{{Name: "a", Prober: &staticProber{}}, {Name: "b", Prober: &staticProber{}}},
+	}, storage)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	healthy := ProbeResult{Name: "a", Success: true, Stats: ProbeStats{Sent: 4, Received: 4}}
+	lossy := ProbeResult{Name: "b", Success: true, Stats: ProbeStats{Sent: 4, Received: 3, Loss: 25}}
+	recovered := ProbeResult{Name: "b", Success: true, Stats: ProbeStats{Sent: 4, Received: 4}}
+
+	for _, results := range [][]ProbeResult{
+		{healthy, recovered},
+		{healthy, lossy},
+		{healthy, lossy},
+		{healthy, recovered},
+		{healthy, recovered},
+	} {
+		monitor.logProbeStats(TickResult{Results: results})
+	}
+
+	// the two lossy ticks and the recovery, nothing for the healthy target
+	if got := strings.Join(storage.probeStats, ","); got != "b,b,b" {
+		t.Errorf("Expected only degraded stats and the recovery to be logged, got %q", got)
+	}
+}
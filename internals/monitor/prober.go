@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Protocol string
+
+const (
+	ProtocolICMP Protocol = "icmp"
+	ProtocolTCP  Protocol = "tcp"
+	ProtocolHTTP Protocol = "http"
+	ProtocolDNS  Protocol = "dns"
+)
+
+// ProbeResult is the outcome of probing a single target once.
+type ProbeResult struct {
+	// Name is the configured target name, filled in by the monitor.
+	Name     string
+	Target   string
+	Protocol Protocol
+	Success  bool
+	Latency  time.Duration
+	Err      error
+	// Stats is filled in when the monitor probes a target in bursts.
+	Stats ProbeStats
+}
+
+// Prober checks reachability of one target. Implementations must respect
+// the context deadline and never block past it.
+type Prober interface {
+	Probe(ctx context.Context) ProbeResult
+}
+
+// NewProber builds a prober for target using the given protocol. The target
+// format depends on the protocol: a host for icmp, host:port for tcp, a URL
+// for http and a hostname to look up for dns.
+func NewProber(protocol Protocol, target string) (Prober, error) {
+	switch protocol {
+	case ProtocolICMP:
+		return &ICMPProber{Target: target, Pinger: NewICMPPinger(defaultProbeTimeout)}, nil
+	case ProtocolTCP:
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return nil, fmt.Errorf("invalid tcp target %q: %w", target, err)
+		}
+		return &TCPProber{Address: target}, nil
+	case ProtocolHTTP:
+		return &HTTPProber{URL: target}, nil
+	case ProtocolDNS:
+		return &DNSProber{Host: target}, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", protocol)
+	}
+}
+
+// describe is the protocol and target the prober would report, for results
+// that are made up without it, like when a tick runs out of time. Probers
+// from outside this package report nothing.
+func describe(prober Prober) (Protocol, string) {
+	switch p := prober.(type) {
+	case *ICMPProber:
+		return ProtocolICMP, p.Target
+	case *TCPProber:
+		return ProtocolTCP, p.Address
+	case *HTTPProber:
+		return ProtocolHTTP, p.URL
+	case *DNSProber:
+		return ProtocolDNS, p.target()
+	}
+	return "", ""
+}
+
+// ICMP
+type ICMPProber struct {
+	Target string
+	Pinger *ICMPPinger
+}
+
+func (p *ICMPProber) Probe(ctx context.Context) ProbeResult {
+	result := ProbeResult{Target: p.Target, Protocol: ProtocolICMP}
+
+	start := time.Now()
+	reply, err := p.Pinger.Echo(ctx, p.Target)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.Err = err
+		return result
+	}
+
+	result.Success = true
+	result.Latency = reply.RTT
+	return result
+}
+
+// TCP connect
+type TCPProber struct {
+	Address string
+}
+
+func (p *TCPProber) Probe(ctx context.Context) ProbeResult {
+	result := ProbeResult{Target: p.Address, Protocol: ProtocolTCP}
+
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	conn.Close()
+
+	result.Success = true
+	return result
+}
+
+// HTTP(S) GET
+type HTTPProber struct {
+	URL string
+	// ExpectedStatus is the status code that counts as success. Zero accepts
+	// any 2xx or 3xx response.
+	ExpectedStatus int
+	Client         *http.Client
+}
+
+func (p *HTTPProber) Probe(ctx context.Context) ProbeResult {
+	result := ProbeResult{Target: p.URL, Protocol: ProtocolHTTP}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	resp.Body.Close()
+
+	if p.ExpectedStatus != 0 && resp.StatusCode != p.ExpectedStatus {
+		result.Err = fmt.Errorf("unexpected status %d, wanted %d", resp.StatusCode, p.ExpectedStatus)
+		return result
+	}
+	if p.ExpectedStatus == 0 && resp.StatusCode >= 400 {
+		result.Err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// DNS resolution
+type DNSProber struct {
+	Host string
+	// Resolver is the host:port of the DNS server to query. Empty uses the
+	// system resolver.
+	Resolver string
+}
+
+func (p *DNSProber) target() string {
+	if p.Resolver != "" {
+		return p.Host + "@" + p.Resolver
+	}
+	return p.Host
+}
+
+func (p *DNSProber) Probe(ctx context.Context) ProbeResult {
+	result := ProbeResult{Target: p.target(), Protocol: ProtocolDNS}
+
+	resolver := net.DefaultResolver
+	if p.Resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, p.Resolver)
+			},
+		}
+	}
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, p.Host)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if len(addrs) == 0 {
+		result.Err = fmt.Errorf("no addresses for %s", p.Host)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbers(t *testing.T) {
+	t.Run("TCP_Success", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer listener.Close()
+
+		prober := &TCPProber{Address: listener.Addr().String()}
+		result := prober.Probe(context.Background())
+		if !result.Success {
+			t.Errorf("Expected tcp probe to succeed, got: %v", result.Err)
+		}
+	})
+
+	t.Run("TCP_Failure", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		address := listener.Addr().String()
+		listener.Close()
+
+		prober := &TCPProber{Address: address}
+		result := prober.Probe(context.Background())
+		if result.Success {
+			t.Errorf("Expected tcp probe to a closed port to fail")
+		}
+	})
+
+	t.Run("HTTP_ExpectedStatus", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		ok := (&HTTPProber{URL: server.URL, ExpectedStatus: http.StatusNoContent}).Probe(context.Background())
+		if !ok.Success {
+			t.Errorf("Expected http probe to succeed, got: %v", ok.Err)
+		}
+
+		wrong := (&HTTPProber{URL: server.URL, ExpectedStatus: http.StatusOK}).Probe(context.Background())
+		if wrong.Success {
+			t.Errorf("Expected http probe with wrong status to fail")
+		}
+	})
+
+	t.Run("HTTP_Timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		result := (&HTTPProber{URL: server.URL}).Probe(ctx)
+		if result.Success {
+			t.Errorf("Expected http probe to time out")
+		}
+	})
+
+	t.Run("NewProber_Invalid", func(t *testing.T) {
+		if _, err := NewProber(ProtocolTCP, "no-port"); err == nil {
+			t.Errorf("Expected error for tcp target without port")
+		}
+		if _, err := NewProber("smtp", "example.com"); err == nil {
+			t.Errorf("Expected error for unknown protocol")
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Resolution is the bucket size of aggregated checks.
+type Resolution string
+
+const (
+	ResolutionMinute Resolution = "minute"
+	ResolutionHour   Resolution = "hour"
+)
+
+func (r Resolution) Duration() time.Duration {
+	if r == ResolutionHour {
+		return time.Hour
+	}
+	return time.Minute
+}
+
+// RollupRecord aggregates the checks of one device in one bucket. The
+// latencies only cover the checks that succeeded.
+type RollupRecord struct {
+	DeviceID   string
+	Resolution Resolution
+	// Bucket is the start of the bucket, in UTC.
+	Bucket   time.Time
+	Count    int
+	Failures int
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+	P95      time.Duration
+}
+
+// RollupReader is implemented by storage that downsamples old checks
+// instead of keeping them forever.
+type RollupReader interface {
+	GetRollups(deviceID string, resolution Resolution, from, to time.Time) ([]RollupRecord, error)
+}
+
+// RollupChecks aggregates checks into buckets of the given resolution,
+// ordered by bucket and device.
+func RollupChecks(checks []CheckRecord, resolution Resolution) []RollupRecord {
+	type key struct {
+		deviceID string
+		bucket   time.Time
+	}
+
+	groups := make(map[key][]CheckRecord)
+	for _, check := range checks {
+		k := key{check.DeviceID, check.Timestamp.UTC().Truncate(resolution.Duration())}
+		groups[k] = append(groups[k], check)
+	}
+
+	result := make([]RollupRecord, 0, len(groups))
+	for k, group := range groups {
+		rollup := RollupRecord{
+			DeviceID:   k.deviceID,
+			Resolution: resolution,
+			Bucket:     k.bucket,
+			Count:      len(group),
+		}
+
+		latencies := make([]time.Duration, 0, len(group))
+		for _, check := range group {
+			if check.Success {
+				latencies = append(latencies, check.ResponseTime)
+			} else {
+				rollup.Failures++
+			}
+		}
+		if len(latencies) > 0 {
+			slices.Sort(latencies)
+			total := time.Duration(0)
+			for _, latency := range latencies {
+				total += latency
+			}
+			rollup.Min = latencies[0]
+			rollup.Max = latencies[len(latencies)-1]
+			rollup.Avg = total / time.Duration(len(latencies))
+			rollup.P95 = percentile(latencies, 95)
+		}
+		result = append(result, rollup)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Bucket.Equal(result[j].Bucket) {
+			return result[i].Bucket.Before(result[j].Bucket)
+		}
+		return result[i].DeviceID < result[j].DeviceID
+	})
+	return result
+}
+
+// estimatePercentile is the p-th percentile of sorted raw latencies
+// together with rolled up ones, see RollupRecord.share for how a bucket is
+// taken to be spread.
+func estimatePercentile(sorted []time.Duration, rollups []RollupRecord, p float64) time.Duration {
+	total := float64(len(sorted))
+	lo, hi := time.Duration(math.MaxInt64), time.Duration(0)
+	if len(sorted) > 0 {
+		lo, hi = sorted[0], sorted[len(sorted)-1]
+	}
+	for _, rollup := range rollups {
+		total += float64(rollup.Count - rollup.Failures)
+		lo, hi = min(lo, rollup.Min), max(hi, rollup.Max)
+	}
+	if total == 0 {
+		return 0
+	}
+
+	// the least latency with at least p percent of the checks at or below it
+	want := p / 100 * total
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		below := float64(sort.Search(len(sorted), func(i int) bool { return sorted[i] > mid }))
+		for _, rollup := range rollups {
+			below += float64(rollup.Count-rollup.Failures) * rollup.share(mid)
+		}
+		if below >= want {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
+
+// share estimates the fraction of the successful checks of the bucket at or
+// below latency. Taking the average as the median, the latencies rise
+// linearly from Min to Avg for the first half, on to P95 and then to Max.
+func (r RollupRecord) share(latency time.Duration) float64 {
+	median := min(max(r.Avg, r.Min), r.Max)
+	p95 := min(max(r.P95, median), r.Max)
+	points := []struct {
+		latency time.Duration
+		share   float64
+	}{{r.Min, 0}, {median, 0.5}, {p95, 0.95}, {r.Max, 1}}
+
+	if latency < r.Min {
+		return 0
+	}
+	for i := 1; i < len(points); i++ {
+		if latency < points[i].latency {
+			a, b := points[i-1], points[i]
+			return a.share + (b.share-a.share)*float64(latency-a.latency)/float64(b.latency-a.latency)
+		}
+	}
+	return 1
+}
+
+// percentile is the nearest rank percentile p (0-100] of sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupChecks(t *testing.T) {
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	checks := []CheckRecord{}
+	// 20 checks in the first minute, latencies 1..20ms, one failure
+	for i := 1; i <= 20; i++ {
+		checks = append(checks, CheckRecord{
+			DeviceID:     "a",
+			Success:      i != 10,
+			ResponseTime: time.Duration(i) * time.Millisecond,
+			Timestamp:    base.Add(time.Duration(i) * time.Second),
+		})
+	}
+	checks = append(checks, CheckRecord{DeviceID: "a", Success: false, Timestamp: base.Add(90 * time.Second)})
+	checks = append(checks, CheckRecord{DeviceID: "b", Success: true, ResponseTime: 5 * time.Millisecond, Timestamp: base.Add(10 * time.Second)})
+
+	t.Run("Minute", func(t *testing.T) {
+		rollups := RollupChecks(checks, ResolutionMinute)
+		if len(rollups) != 3 {
+			t.Fatalf("Expected 3 minute rollups, got %d: %+v", len(rollups), rollups)
+		}
+
+		first := rollups[0]
+		if first.DeviceID != "a" || !first.Bucket.Equal(base) {
+			t.Fatalf("Expected device a at %v first, got %+v", base, first)
+		}
+		if first.Count != 20 || first.Failures != 1 {
+			t.Errorf("Expected 20 checks with 1 failure, got %d/%d", first.Count, first.Failures)
+		}
+		if first.Min != time.Millisecond || first.Max != 20*time.Millisecond {
+			t.Errorf("Expected min 1ms max 20ms, got %v %v", first.Min, first.Max)
+		}
+		// 19 latencies, rank ceil(0.95*19) = 19
+		if first.P95 != 20*time.Millisecond {
+			t.Errorf("Expected p95 of 20ms, got %v", first.P95)
+		}
+
+		if rollups[2].Failures != 1 || rollups[2].Avg != 0 {
+			t.Errorf("Expected an all failed bucket without latency, got %+v", rollups[2])
+		}
+	})
+
+	t.Run("Hour", func(t *testing.T) {
+		rollups := RollupChecks(checks, ResolutionHour)
+		if len(rollups) != 2 {
+			t.Fatalf("Expected one hour rollup per device, got %d", len(rollups))
+		}
+		if rollups[0].Count != 21 || rollups[0].Failures != 2 {
+			t.Errorf("Expected 21 checks with 2 failures, got %d/%d", rollups[0].Count, rollups[0].Failures)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"time"
+)
+
+// Clock is the time source of the state machine, swapped out in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Transition is everything the state machine decided for one tick.
+type Transition struct {
+	At time.Time
+	// Observed is the raw status of the tick before hysteresis.
+	Observed ConnectionStatus
+	// Status is the status to report after this tick.
+	Status  ConnectionStatus
+	Changes []StatusChange
+	Flap    *FlapIncident
+
+	OutageStarted  bool
+	OutageEnded    bool
+	OutageDuration time.Duration
+	// Anomaly is set when the status just turned Anomalous.
+	Anomaly *LatencyAnomaly
+	// Alert is set when an outage just ended, an anomaly began or flapping
+	// settled, and should be notified. Flapping is a single incident, the
+	// outages inside it are neither recorded nor alerted.
+	Alert bool
+}
+
+// StateMachine turns probe results into status changes and outages. It has
+// no side effects, the monitor applies the returned transitions.
+type StateMachine struct {
+	clock      Clock
+	thresholds Thresholds
+	tracker    *statusTracker
+
+	inOutage    bool
+	outageStart time.Time
+}
+
+func NewStateMachine(thresholds Thresholds, hysteresis Hysteresis, clock Clock) *StateMachine {
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	return &StateMachine{
+		clock:      clock,
+		thresholds: thresholds,
+		tracker:    newStatusTracker(hysteresis, Running),
+	}
+}
+
+// Status is the status currently reported.
+func (m *StateMachine) Status() ConnectionStatus {
+	return m.tracker.Reported()
+}
+
+// OutageStart reports when the current outage began, if there is one.
+func (m *StateMachine) OutageStart() (time.Time, bool) {
+	return m.outageStart, m.inOutage
+}
+
+// ResumeOutage continues an outage that started before the machine did.
+func (m *StateMachine) ResumeOutage(start time.Time) {
+	m.inOutage = true
+	m.outageStart = start
+	m.tracker.current = Down
+	m.tracker.candidate = Down
+}
+
+// Observe feeds one tick into the state machine.
+func (m *StateMachine) Observe(tick TickResult) Transition {
+	now := m.clock.Now()
+
+	observed := Down
+	if !tick.Down {
+		observed = m.thresholds.Classify(tick)
+	}
+
+	changes, flap := m.tracker.observe(observed, now)
+	transition := Transition{
+		At:       now,
+		Observed: observed,
+		Status:   m.tracker.Reported(),
+		Changes:  changes,
+		Flap:     flap,
+	}
+	for _, change := range changes {
+		if change.To == Anomalous && tick.Anomaly != nil {
+			transition.Anomaly = tick.Anomaly
+			transition.Alert = true
+		}
+	}
+
+	// outages follow the debounced status, except while flapping. Once the
+	// flap settles the outage catches up with where it ended, and the flap
+	// is what gets alerted.
+	if m.tracker.flapping {
+		return transition
+	}
+	isDown := m.tracker.current == Down
+	if !m.inOutage && isDown {
+		m.inOutage = true
+		m.outageStart = now
+		transition.OutageStarted = true
+	} else if m.inOutage && !isDown {
+		m.inOutage = false
+		transition.OutageEnded = true
+		transition.OutageDuration = now.Sub(m.outageStart)
+		transition.Alert = true
+	}
+	if flap != nil {
+		transition.Alert = true
+	}
+
+	return transition
+}
@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func TestStateMachine(t *testing.T) {
+	up := TickResult{
+		Results:        []ProbeResult{{Success: true, Latency: 20 * time.Millisecond, Stats: ProbeStats{Sent: 1, Received: 1}}},
+		AverageLatency: 20 * time.Millisecond,
+	}
+	slow := TickResult{
+		Results:        []ProbeResult{{Success: true, Latency: 4 * time.Second, Stats: ProbeStats{Sent: 1, Received: 1}}},
+		AverageLatency: 4 * time.Second,
+	}
+	down := TickResult{Results: []ProbeResult{{Stats: ProbeStats{Sent: 1}}}, Down: true}
+
+	newMachine := func() (*StateMachine, *fakeClock) {
+		clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		hysteresis := Hysteresis{Enter: map[ConnectionStatus]int{Down: 3}, DefaultEnter: 1, DefaultExit: 1}
+		return NewStateMachine(DefaultThresholds(), hysteresis, clock), clock
+	}
+
+	t.Run("OutageTiming", func(t *testing.T) {
+		machine, clock := newMachine()
+		start := clock.now
+
+		for i := 0; i < 2; i++ {
+			clock.Advance(time.Second)
+			if transition := machine.Observe(down); transition.OutageStarted {
+				t.Fatalf("Expected no outage before the third failure")
+			}
+		}
+
+		clock.Advance(time.Second)
+		transition := machine.Observe(down)
+		if !transition.OutageStarted || transition.Status != Down {
+			t.Fatalf("Expected outage to start on the third failure, got: %+v", transition)
+		}
+		if outageStart, ok := machine.OutageStart(); !ok || !outageStart.Equal(start.Add(3*time.Second)) {
+			t.Errorf("Unexpected outage start: %v", outageStart)
+		}
+
+		clock.Advance(time.Minute)
+		machine.Observe(down)
+
+		clock.Advance(time.Second)
+		transition = machine.Observe(up)
+		if !transition.OutageEnded || !transition.Alert {
+			t.Fatalf("Expected outage to end with an alert, got: %+v", transition)
+		}
+		if transition.OutageDuration != time.Minute+time.Second {
+			t.Errorf("Expected outage of 1m1s, got: %v", transition.OutageDuration)
+		}
+		if len(transition.Changes) != 1 || transition.Changes[0].From != Down || transition.Changes[0].To != Running {
+			t.Errorf("Expected a single down to running change, got: %v", transition.Changes)
+		}
+	})
+
+	t.Run("SlowDetection", func(t *testing.T) {
+		machine, clock := newMachine()
+
+		clock.Advance(time.Second)
+		transition := machine.Observe(slow)
+		if transition.Status != Slow || transition.Alert {
+			t.Errorf("Expected slow without alert, got: %+v", transition)
+		}
+
+		clock.Advance(time.Second)
+		if transition := machine.Observe(up); transition.Status != Running {
+			t.Errorf("Expected running again, got: %s", transition.Status)
+		}
+	})
+
+	t.Run("NoAlertWithoutOutage", func(t *testing.T) {
+		machine, clock := newMachine()
+
+		for _, tick := range []TickResult{down, up, down, down, up} {
+			clock.Advance(time.Second)
+			if transition := machine.Observe(tick); transition.Alert || transition.OutageStarted {
+				t.Errorf("Expected short failures not to count as an outage, got: %+v", transition)
+			}
+		}
+	})
+
+	t.Run("AnomalyAlert", func(t *testing.T) {
+		machine, clock := newMachine()
+		anomalous := up
+		anomalous.Anomaly = &LatencyAnomaly{Latency: 200 * time.Millisecond, Expected: 20 * time.Millisecond}
+
+		clock.Advance(time.Second)
+		transition := machine.Observe(anomalous)
+		if transition.Status != Anomalous || !transition.Alert || transition.Anomaly != anomalous.Anomaly {
+			t.Errorf("Expected an anomaly alert, got: %+v", transition)
+		}
+
+		// only entering the anomaly alerts
+		clock.Advance(time.Second)
+		if transition := machine.Observe(anomalous); transition.Alert || transition.Anomaly != nil {
+			t.Errorf("Expected one alert per anomaly, got: %+v", transition)
+		}
+		clock.Advance(time.Second)
+		if transition := machine.Observe(up); transition.Status != Running || transition.Alert {
+			t.Errorf("Expected a quiet return to running, got: %+v", transition)
+		}
+	})
+
+	t.Run("FlapIsOneIncident", func(t *testing.T) {
+		clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		hysteresis := Hysteresis{DefaultEnter: 1, DefaultExit: 1, FlapTransitions: 4, FlapWindow: time.Minute}
+		machine := NewStateMachine(DefaultThresholds(), hysteresis, clock)
+
+		alerts, outages := 0, 0
+		observe := func(tick TickResult) Transition {
+			clock.Advance(time.Second)
+			transition := machine.Observe(tick)
+			if transition.Alert {
+				alerts++
+			}
+			if transition.OutageStarted {
+				outages++
+			}
+			return transition
+		}
+
+		// the fourth change starts flapping, the first outage is still open
+		for _, tick := range []TickResult{down, up, down, up} {
+			observe(tick)
+		}
+		if machine.Status() != Flapping || alerts != 1 || outages != 2 {
+			t.Fatalf("Expected flapping after one alerted outage, got %s with %d alerts and %d outages", machine.Status(), alerts, outages)
+		}
+
+		for i := 0; i < 20; i++ {
+			observe(down)
+			observe(up)
+		}
+		if alerts != 1 || outages != 2 {
+			t.Errorf("Expected no outages or alerts while flapping, got %d alerts and %d outages", alerts, outages)
+		}
+
+		// a quiet window settles the flap, with one alert for all of it
+		var settled Transition
+		for settled.Flap == nil {
+			settled = observe(up)
+		}
+		if !settled.Alert || !settled.OutageEnded || settled.Status != Running {
+			t.Errorf("Expected the flap to settle with one alert and close the outage, got %+v", settled)
+		}
+		if settled.Flap.Transitions != 44 || alerts != 2 {
+			t.Errorf("Expected a single flap alert over 44 changes, got %d changes and %d alerts", settled.Flap.Transitions, alerts)
+		}
+	})
+}
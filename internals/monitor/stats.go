@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"time"
+)
+
+// ProbeStats summarises a burst of probes against one target.
+type ProbeStats struct {
+	Sent     int
+	Received int
+	// Loss is the percentage of probes that got no reply.
+	Loss   float64
+	Min    time.Duration
+	Avg    time.Duration
+	Max    time.Duration
+	Jitter time.Duration
+}
+
+// newProbeStats computes loss, min/avg/max and jitter from the round trip
+// times of the probes that were answered, in the order they were sent.
+// Jitter is the RFC 3550 interarrival estimate, smoothed by 1/16 per sample.
+func newProbeStats(sent int, rtts []time.Duration) ProbeStats {
+	stats := ProbeStats{Sent: sent, Received: len(rtts)}
+	if sent > 0 {
+		stats.Loss = float64(sent-len(rtts)) / float64(sent) * 100
+	}
+	if len(rtts) == 0 {
+		return stats
+	}
+
+	stats.Min, stats.Max = rtts[0], rtts[0]
+	total := time.Duration(0)
+	jitter := 0.0
+
+	for i, rtt := range rtts {
+		total += rtt
+		if rtt < stats.Min {
+			stats.Min = rtt
+		}
+		if rtt > stats.Max {
+			stats.Max = rtt
+		}
+
+		if i > 0 {
+			d := float64(rtt - rtts[i-1])
+			if d < 0 {
+				d = -d
+			}
+			jitter += (d - jitter) / 16
+		}
+	}
+
+	stats.Avg = total / time.Duration(len(rtts))
+	stats.Jitter = time.Duration(jitter)
+	return stats
+}
+
+// combineStats merges the per target stats of a tick into one summary for
+// the device. Jitter is averaged over the targets that answered.
+func combineStats(results []ProbeResult) ProbeStats {
+	combined := ProbeStats{}
+	total, jitter, answered := time.Duration(0), time.Duration(0), 0
+
+	for _, result := range results {
+		stats := result.Stats
+		combined.Sent += stats.Sent
+		combined.Received += stats.Received
+		if stats.Received == 0 {
+			continue
+		}
+
+		if answered == 0 || stats.Min < combined.Min {
+			combined.Min = stats.Min
+		}
+		if stats.Max > combined.Max {
+			combined.Max = stats.Max
+		}
+		total += stats.Avg * time.Duration(stats.Received)
+		jitter += stats.Jitter
+		answered++
+	}
+
+	if combined.Sent > 0 {
+		combined.Loss = float64(combined.Sent-combined.Received) / float64(combined.Sent) * 100
+	}
+	if combined.Received > 0 {
+		combined.Avg = total / time.Duration(combined.Received)
+		combined.Jitter = jitter / time.Duration(answered)
+	}
+
+	return combined
+}
+
+// probeBurst runs the prober size times, spaced by interval, and folds the
+// replies into a single result. The result succeeds if any probe answered.
+func probeBurst(ctx context.Context, prober Prober, size int, interval, timeout time.Duration) ProbeResult {
+	var last ProbeResult
+	var lastErr error
+	rtts := make([]time.Duration, 0, size)
+	sent := 0
+
+	for i := 0; i < size; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		// the tick deadline passed, whatever is left counts as lost
+		if ctx.Err() != nil {
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			sent = size
+			break
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		last = prober.Probe(probeCtx)
+		cancel()
+		sent++
+
+		if last.Success {
+			rtts = append(rtts, last.Latency)
+		} else {
+			lastErr = last.Err
+		}
+	}
+
+	result := last
+	result.Stats = newProbeStats(sent, rtts)
+	result.Success = len(rtts) > 0
+	if result.Success {
+		result.Latency = result.Stats.Avg
+		result.Err = nil
+	} else {
+		result.Err = lastErr
+	}
+
+	return result
+}
@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyProber answers every probe except the ones listed in drop. With hang
+// set the dropped ones wait out their timeout, like a lost echo.
+type flakyProber struct {
+	calls   int
+	drop    map[int]bool
+	latency []time.Duration
+	hang    bool
+}
+
+func (f *flakyProber) Probe(ctx context.Context) ProbeResult {
+	call := f.calls
+	f.calls++
+	if f.drop[call] {
+		if f.hang {
+			<-ctx.Done()
+		}
+		return ProbeResult{Err: errors.New("lost")}
+	}
+	return ProbeResult{Success: true, Latency: f.latency[call%len(f.latency)]}
+}
+
+func TestNewProbeStats(t *testing.T) {
+	ms := time.Millisecond
+	stats := newProbeStats(5, []time.Duration{10 * ms, 30 * ms, 20 * ms, 20 * ms})
+
+	if stats.Loss != 20 {
+		t.Errorf("Expected 20%% loss, got: %v", stats.Loss)
+	}
+	if stats.Min != 10*ms || stats.Max != 30*ms || stats.Avg != 20*ms {
+		t.Errorf("Unexpected min/avg/max: %v/%v/%v", stats.Min, stats.Avg, stats.Max)
+	}
+
+	// J1 = 20/16, J2 = J1 + (10 - J1)/16, J3 = J2 - J2/16
+	j1 := 20.0 / 16
+	j2 := j1 + (10-j1)/16
+	j3 := j2 - j2/16
+	want := time.Duration(j3 * float64(ms))
+	if diff := stats.Jitter - want; diff > time.Microsecond || diff < -time.Microsecond {
+		t.Errorf("Expected jitter %v, got: %v", want, stats.Jitter)
+	}
+
+	empty := newProbeStats(3, nil)
+	if empty.Loss != 100 || empty.Received != 0 {
+		t.Errorf("Expected full loss with no replies, got: %+v", empty)
+	}
+}
+
+func TestLostEchoIsLoss(t *testing.T) {
+	config := DefaultConfig()
+	config.Targets = []Target{{Name: "flaky", Prober: &flakyProber{
+		drop:    map[int]bool{0: true},
+		latency: []time.Duration{20 * time.Millisecond},
+		hang:    true,
+	}}}
+	monitor, err := NewWithConfig(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	// the first echo times out, the other two still fit in the tick
+	tick := monitor.probeTargets(context.Background())
+	result := tick.Results[0]
+	if !result.Success || result.Stats.Sent != 3 || result.Stats.Received != 2 {
+		t.Fatalf("Expected 2 of 3 echoes answered, got %+v", result.Stats)
+	}
+	if status := config.Thresholds.Classify(tick); status != Lossy {
+		t.Errorf("Expected a lost echo to make the connection lossy, got %s", status)
+	}
+}
+
+func TestProbeBurst(t *testing.T) {
+	prober := &flakyProber{
+		drop:    map[int]bool{1: true},
+		latency: []time.Duration{5 * time.Millisecond},
+	}
+
+	result := probeBurst(context.Background(), prober, 4, 0, time.Second)
+	if !result.Success {
+		t.Fatalf("Expected burst with replies to succeed, got: %v", result.Err)
+	}
+	if result.Stats.Sent != 4 || result.Stats.Received != 3 {
+		t.Errorf("Expected 3 of 4 replies, got: %+v", result.Stats)
+	}
+	if result.Stats.Loss != 25 {
+		t.Errorf("Expected 25%% loss, got: %v", result.Stats.Loss)
+	}
+
+	allLost := probeBurst(context.Background(), &flakyProber{drop: map[int]bool{0: true, 1: true}}, 2, 0, time.Second)
+	if allLost.Success || allLost.Err == nil {
+		t.Errorf("Expected burst with no replies to fail with an error")
+	}
+}
+
+func TestCombineStats(t *testing.T) {
+	ms := time.Millisecond
+	results := []ProbeResult{
+		{Stats: ProbeStats{Sent: 2, Received: 2, Min: 10 * ms, Avg: 15 * ms, Max: 20 * ms, Jitter: 2 * ms}},
+		{Stats: ProbeStats{Sent: 2, Received: 0, Loss: 100}},
+		{Stats: ProbeStats{Sent: 2, Received: 2, Min: 5 * ms, Avg: 25 * ms, Max: 40 * ms, Jitter: 4 * ms}},
+	}
+
+	combined := combineStats(results)
+	if combined.Sent != 6 || combined.Received != 4 {
+		t.Errorf("Unexpected counts: %+v", combined)
+	}
+	if combined.Min != 5*ms || combined.Max != 40*ms || combined.Avg != 20*ms || combined.Jitter != 3*ms {
+		t.Errorf("Unexpected combined stats: %+v", combined)
+	}
+}
@@ -0,0 +1,355 @@
+package monitor
+
+import (
+	"slices"
+	"time"
+)
+
+// StorageWriter receives every event the monitor produces.
+type StorageWriter interface {
+	LogConnectivityCheck(deviceID string, success bool, responseTime time.Duration, timestamp time.Time, err error) error
+	LogStatusChange(deviceID string, from, to ConnectionStatus, timestamp time.Time) error
+	LogOutageStart(deviceID string, timestamp time.Time) error
+	LogOutageEnd(deviceID string, duration time.Duration, timestamp time.Time) error
+	LogProbeStats(deviceID string, target string, stats ProbeStats, timestamp time.Time) error
+	LogFlapIncident(deviceID string, start, end time.Time, transitions int) error
+}
+
+// StorageReader queries what was written. Time ranges are [from, to) and an
+// empty device ID matches every device.
+type StorageReader interface {
+	GetChecks(deviceID string, from, to time.Time) ([]CheckRecord, error)
+	GetStatusChanges(deviceID string, from, to time.Time) ([]StatusChangeRecord, error)
+	GetOutages(query OutageQuery) ([]OutageRecord, error)
+	GetDeviceStats(deviceID string, from, to time.Time) (DeviceStats, error)
+	GetDevices() ([]DeviceInfo, error)
+}
+
+// Storage is a backend that can both record and answer queries.
+type Storage interface {
+	StorageWriter
+	StorageReader
+	Close() error
+}
+
+// OutageRecovery is implemented by storage that can report outages left
+// open by a previous run, so a restarted monitor can resume or close them.
+type OutageRecovery interface {
+	GetOpenOutage(deviceID string) (time.Time, bool, error)
+	GetLastCheck(deviceID string) (time.Time, bool, error)
+	MarkOutageInterrupted(deviceID string) error
+}
+
+// DeviceRegistry is implemented by storage that keeps a table of known
+// devices. The monitor registers itself on start.
+type DeviceRegistry interface {
+	RegisterDevice(device DeviceInfo) error
+}
+
+// AnomalyWriter is implemented by storage that records latency anomalies
+// as events of their own, next to the status change into Anomalous.
+type AnomalyWriter interface {
+	LogLatencyAnomaly(deviceID string, anomaly LatencyAnomaly) error
+}
+
+// Flusher is implemented by storage that buffers writes. The monitor
+// flushes it on shutdown.
+type Flusher interface {
+	Flush() error
+}
+
+type CheckRecord struct {
+	DeviceID     string
+	Success      bool
+	ResponseTime time.Duration
+	Timestamp    time.Time
+	Error        string
+}
+
+type StatusChangeRecord struct {
+	DeviceID  string
+	From      ConnectionStatus
+	To        ConnectionStatus
+	Timestamp time.Time
+}
+
+type OutageRecord struct {
+	ID       int64
+	DeviceID string
+	Start    time.Time
+	// End is zero while the outage is still open.
+	End         time.Time
+	Duration    time.Duration
+	Interrupted bool
+}
+
+func (o OutageRecord) Open() bool {
+	return o.End.IsZero()
+}
+
+// overlap is how much of the outage falls inside [from, to). Open outages
+// are counted up to now.
+func (o OutageRecord) overlap(from, to, now time.Time) time.Duration {
+	end := o.End
+	if o.Open() {
+		end = now
+	}
+
+	start := o.Start
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+type OutageState int
+
+const (
+	OutagesAny OutageState = iota
+	OutagesOpen
+	OutagesClosed
+)
+
+// OutageQuery selects outages. Zero values leave a filter off.
+type OutageQuery struct {
+	DeviceIDs []string
+	// From and To select outages overlapping [From, To), so an outage that
+	// started before From but was still going on at From is included.
+	From time.Time
+	To   time.Time
+	// MinDuration also applies to open outages, counting up to now.
+	MinDuration time.Duration
+	State       OutageState
+
+	Limit  int
+	Offset int
+	// Newest first instead of oldest first, by start time.
+	Descending bool
+}
+
+// matches applies every filter except pagination.
+func (q OutageQuery) matches(o OutageRecord, now time.Time) bool {
+	if len(q.DeviceIDs) > 0 && !slices.Contains(q.DeviceIDs, o.DeviceID) {
+		return false
+	}
+	if !q.To.IsZero() && !o.Start.Before(q.To) {
+		return false
+	}
+	if !q.From.IsZero() && !o.Open() && !o.End.After(q.From) {
+		return false
+	}
+
+	switch q.State {
+	case OutagesOpen:
+		if !o.Open() {
+			return false
+		}
+	case OutagesClosed:
+		if o.Open() {
+			return false
+		}
+	}
+
+	duration := o.Duration
+	if o.Open() {
+		duration = now.Sub(o.Start)
+	}
+	return duration >= q.MinDuration
+}
+
+// DeviceStats summarises a device over a time range.
+type DeviceStats struct {
+	DeviceID       string
+	From           time.Time
+	To             time.Time
+	Checks         int
+	FailedChecks   int
+	AverageLatency time.Duration
+	// latency percentiles of the successful checks. Rolled up checks only
+	// keep their min, average, p95 and max, with any of them in the range
+	// the percentiles are estimated and ApproximatePercentiles is set.
+	P50Latency             time.Duration
+	P90Latency             time.Duration
+	P99Latency             time.Duration
+	ApproximatePercentiles bool
+
+	Outages int
+	// TotalDowntime and MeanDowntime only count the part of each outage
+	// inside the range, LongestOutage and MTTR use the whole outage.
+	TotalDowntime time.Duration
+	MeanDowntime  time.Duration
+	LongestOutage time.Duration
+	// Uptime is the percentage of the monitored part of the range up to now
+	// without an outage. Time counts as monitored when it has checks,
+	// rollups or an outage, gaps of up to maxCoverageGap between them are
+	// bridged. Zero when nothing was monitored.
+	Uptime float64
+	// MTBF is the mean uptime between outages, MTTR the mean duration of
+	// the outages that ended. Both are zero without outages.
+	MTBF time.Duration
+	MTTR time.Duration
+
+	// kept so AddRollups can fold in more checks
+	latencies []time.Duration
+	coverage  []span
+	until     time.Time
+}
+
+// maxCoverageGap is the longest stretch without checks that still counts as
+// monitored, anything longer is taken as the monitor not running.
+const maxCoverageGap = 5 * time.Minute
+
+type span struct {
+	start, end time.Time
+}
+
+// ComputeDeviceStats builds the stats for a range from its raw checks and
+// outages, so every backend reports them the same way.
+func ComputeDeviceStats(deviceID string, from, to time.Time, checks []CheckRecord, outages []OutageRecord) DeviceStats {
+	return computeDeviceStats(deviceID, from, to, checks, outages, time.Now())
+}
+
+func computeDeviceStats(deviceID string, from, to time.Time, checks []CheckRecord, outages []OutageRecord, now time.Time) DeviceStats {
+	stats := DeviceStats{DeviceID: deviceID, From: from, To: to}
+
+	// the future can't have been up
+	stats.until = to
+	if stats.until.After(now) {
+		stats.until = now
+	}
+
+	total := time.Duration(0)
+	latencies := make([]time.Duration, 0, len(checks))
+	for _, check := range checks {
+		stats.Checks++
+		stats.coverage = append(stats.coverage, span{check.Timestamp, check.Timestamp})
+		if !check.Success {
+			stats.FailedChecks++
+			continue
+		}
+		total += check.ResponseTime
+		latencies = append(latencies, check.ResponseTime)
+	}
+	if len(latencies) > 0 {
+		stats.AverageLatency = total / time.Duration(len(latencies))
+		slices.Sort(latencies)
+		stats.P50Latency = percentile(latencies, 50)
+		stats.P90Latency = percentile(latencies, 90)
+		stats.P99Latency = percentile(latencies, 99)
+	}
+	stats.latencies = latencies
+
+	repaired, repairTime := 0, time.Duration(0)
+	for _, outage := range outages {
+		stats.Outages++
+		stats.TotalDowntime += outage.overlap(from, to, now)
+
+		duration := outage.Duration
+		stats.coverage = append(stats.coverage, span{outage.Start, outage.Start.Add(duration)})
+		if outage.Open() {
+			duration = now.Sub(outage.Start)
+			stats.coverage[len(stats.coverage)-1].end = now
+		} else {
+			repaired++
+			repairTime += outage.Duration
+		}
+		stats.LongestOutage = max(stats.LongestOutage, duration)
+	}
+
+	stats.updateUptime()
+	if stats.Outages > 0 {
+		stats.MeanDowntime = stats.TotalDowntime / time.Duration(stats.Outages)
+	}
+	if repaired > 0 {
+		stats.MTTR = repairTime / time.Duration(repaired)
+	}
+
+	return stats
+}
+
+// AddRollups counts checks that were downsampled. They add to the check
+// counts, the average latency and the monitored time, and turn the
+// percentiles into estimates.
+func (s *DeviceStats) AddRollups(rollups []RollupRecord) {
+	succeeded := s.Checks - s.FailedChecks
+	total := s.AverageLatency * time.Duration(succeeded)
+
+	answered := make([]RollupRecord, 0, len(rollups))
+	for _, rollup := range rollups {
+		s.Checks += rollup.Count
+		s.FailedChecks += rollup.Failures
+		s.coverage = append(s.coverage, span{rollup.Bucket, rollup.Bucket.Add(rollup.Resolution.Duration())})
+		ok := rollup.Count - rollup.Failures
+		if ok == 0 {
+			continue
+		}
+		total += rollup.Avg * time.Duration(ok)
+		succeeded += ok
+		answered = append(answered, rollup)
+	}
+	if succeeded > 0 {
+		s.AverageLatency = total / time.Duration(succeeded)
+	}
+	if len(answered) > 0 {
+		s.P50Latency = estimatePercentile(s.latencies, answered, 50)
+		s.P90Latency = estimatePercentile(s.latencies, answered, 90)
+		s.P99Latency = estimatePercentile(s.latencies, answered, 99)
+		s.ApproximatePercentiles = true
+	}
+	s.updateUptime()
+}
+
+// updateUptime works out Uptime and MTBF over the monitored part of the
+// range.
+func (s *DeviceStats) updateUptime() {
+	s.Uptime, s.MTBF = 0, 0
+	monitored := coveredTime(s.coverage, s.From, s.until)
+	if monitored <= 0 {
+		return
+	}
+	up := max(monitored-s.TotalDowntime, 0)
+	s.Uptime = float64(up) / float64(monitored) * 100
+	if s.Outages > 0 {
+		s.MTBF = up / time.Duration(s.Outages)
+	}
+}
+
+// coveredTime is how much of [from, to) the spans cover, bridging gaps of
+// up to maxCoverageGap.
+func coveredTime(spans []span, from, to time.Time) time.Duration {
+	spans = slices.Clone(spans)
+	slices.SortFunc(spans, func(a, b span) int {
+		return a.start.Compare(b.start)
+	})
+
+	covered := time.Duration(0)
+	add := func(s span) {
+		start, end := s.start, s.end
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			covered += end.Sub(start)
+		}
+	}
+
+	for i := 0; i < len(spans); {
+		current := spans[i]
+		for i++; i < len(spans) && !spans[i].start.After(current.end.Add(maxCoverageGap)); i++ {
+			if spans[i].end.After(current.end) {
+				current.end = spans[i].end
+			}
+		}
+		add(current)
+	}
+	return covered
+}
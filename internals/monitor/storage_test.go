@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeDeviceStats(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(10 * time.Hour)
+
+	checks := []CheckRecord{}
+	for i := 1; i <= 100; i++ {
+		checks = append(checks, CheckRecord{DeviceID: "a", Success: true, ResponseTime: time.Duration(i) * time.Millisecond, Timestamp: from.Add(time.Duration(i) * time.Minute)})
+	}
+	checks = append(checks, CheckRecord{DeviceID: "a", Success: false, Timestamp: from.Add(time.Hour)})
+
+	outages := []OutageRecord{
+		// started before the range, 30 of its 60 minutes fall inside
+		{DeviceID: "a", Start: from.Add(-30 * time.Minute), End: from.Add(30 * time.Minute), Duration: time.Hour},
+		{DeviceID: "a", Start: from.Add(2 * time.Hour), End: from.Add(2*time.Hour + 10*time.Minute), Duration: 10 * time.Minute},
+		// still open, now is at 5h
+		{DeviceID: "a", Start: from.Add(4 * time.Hour)},
+	}
+
+	t.Run("Latency", func(t *testing.T) {
+		stats := computeDeviceStats("a", from, to, checks, outages, from.Add(5*time.Hour))
+		if stats.Checks != 101 || stats.FailedChecks != 1 {
+			t.Errorf("Expected 101 checks with 1 failure, got %d/%d", stats.Checks, stats.FailedChecks)
+		}
+		if stats.P50Latency != 50*time.Millisecond || stats.P90Latency != 90*time.Millisecond || stats.P99Latency != 99*time.Millisecond {
+			t.Errorf("Unexpected percentiles %v/%v/%v", stats.P50Latency, stats.P90Latency, stats.P99Latency)
+		}
+		if stats.AverageLatency != 50500*time.Microsecond {
+			t.Errorf("Expected an average of 50.5ms, got %v", stats.AverageLatency)
+		}
+	})
+
+	t.Run("Downtime", func(t *testing.T) {
+		stats := computeDeviceStats("a", from, to, checks, outages, from.Add(5*time.Hour))
+
+		// 30m + 10m + 1h open
+		if stats.Outages != 3 || stats.TotalDowntime != 100*time.Minute {
+			t.Errorf("Expected 3 outages over 100m, got %d over %v", stats.Outages, stats.TotalDowntime)
+		}
+		if stats.LongestOutage != time.Hour {
+			t.Errorf("Expected the longest outage to be 1h, got %v", stats.LongestOutage)
+		}
+		if stats.MTTR != 35*time.Minute {
+			t.Errorf("Expected MTTR of 35m over the closed outages, got %v", stats.MTTR)
+		}
+		// only monitored time up to now counts: the checks up to 1h40m joined
+		// with the first outage, and the other two outages, 170 minutes of
+		// which 70 were up
+		if stats.MTBF != 70*time.Minute/3 {
+			t.Errorf("Expected MTBF of 23m20s, got %v", stats.MTBF)
+		}
+		if stats.Uptime < 41.17 || stats.Uptime > 41.18 {
+			t.Errorf("Expected 41.18%% uptime, got %.2f", stats.Uptime)
+		}
+	})
+
+	t.Run("NoOutages", func(t *testing.T) {
+		stats := computeDeviceStats("a", from, to, checks, nil, to)
+		if stats.Uptime != 100 || stats.MTBF != 0 || stats.MTTR != 0 {
+			t.Errorf("Expected full uptime without MTBF/MTTR, got %+v", stats)
+		}
+	})
+
+	t.Run("AddRollups", func(t *testing.T) {
+		stats := computeDeviceStats("a", from, to, checks[:2], nil, to)
+		stats.AddRollups([]RollupRecord{{Count: 10, Failures: 2, Avg: 10 * time.Millisecond}})
+		// 1ms and 2ms raw, 8 rolled up checks at 10ms
+		if stats.Checks != 12 || stats.FailedChecks != 2 || stats.AverageLatency != 8300*time.Microsecond {
+			t.Errorf("Unexpected stats after rollups: %d/%d %v", stats.Checks, stats.FailedChecks, stats.AverageLatency)
+		}
+	})
+
+	t.Run("RollupPercentiles", func(t *testing.T) {
+		stats := computeDeviceStats("a", from, to, nil, nil, to)
+		stats.AddRollups([]RollupRecord{{Count: 100, Min: 10 * time.Millisecond, Avg: 20 * time.Millisecond, P95: 40 * time.Millisecond, Max: 100 * time.Millisecond}})
+		if !stats.ApproximatePercentiles || stats.P50Latency != 20*time.Millisecond {
+			t.Errorf("Expected the average as the estimated median, got %v", stats.P50Latency)
+		}
+		// 4 of the last 5% between the p95 and the max
+		if diff := stats.P99Latency - 88*time.Millisecond; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("Expected an estimated p99 of 88ms, got %v", stats.P99Latency)
+		}
+	})
+
+	t.Run("RollupCoverage", func(t *testing.T) {
+		// half an hour down and nothing else known about the range
+		down := []OutageRecord{{DeviceID: "a", Start: from.Add(time.Hour), End: from.Add(90 * time.Minute), Duration: 30 * time.Minute}}
+		stats := computeDeviceStats("a", from, to, nil, down, to)
+		if stats.Uptime != 0 {
+			t.Errorf("Expected no uptime with only the outage monitored, got %.2f", stats.Uptime)
+		}
+
+		stats.AddRollups([]RollupRecord{
+			{Resolution: ResolutionHour, Bucket: from.Add(time.Hour), Count: 100, Failures: 50},
+			{Resolution: ResolutionHour, Bucket: from.Add(2 * time.Hour), Count: 100},
+		})
+		if stats.Uptime != 75 {
+			t.Errorf("Expected 90 of the 120 monitored minutes up, got %.2f", stats.Uptime)
+		}
+	})
+}
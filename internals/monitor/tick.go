@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"context"
+	"time"
+)
+
+// TickResult is one round of probes across every configured target.
+type TickResult struct {
+	Started  time.Time
+	Duration time.Duration
+	// Results is in the same order as the monitor targets.
+	Results        []ProbeResult
+	Down           bool
+	AverageLatency time.Duration
+	// Stats combines the burst statistics of every target.
+	Stats ProbeStats
+	// Anomaly is set by the monitor, before the tick reaches the state
+	// machine, when the recent latency is anomalous.
+	Anomaly *LatencyAnomaly
+}
+
+// Answered returns the names of the targets that replied successfully.
+func (t TickResult) Answered() []string {
+	names := []string{}
+	for _, result := range t.Results {
+		if result.Success {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
+
+// Failed returns the names of the targets that did not reply.
+func (t TickResult) Failed() []string {
+	names := []string{}
+	for _, result := range t.Results {
+		if !result.Success {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
+
+// SlowerThan returns the names of the targets that replied, but took longer
+// than latency.
+func (t TickResult) SlowerThan(latency time.Duration) []string {
+	names := []string{}
+	for _, result := range t.Results {
+		if result.Success && result.Latency > latency {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
+
+// probeTargets probes all targets concurrently, each with a burst of
+// probes. Every probe gets its own timeout and the whole round is cut off
+// at the tick timeout, with any target that has not answered by then
+// recorded as failed.
+func (w *WifiMonitor) probeTargets(ctx context.Context) TickResult {
+	tickCtx, cancel := context.WithTimeout(ctx, w.tickTimeout)
+	defer cancel()
+
+	tick := TickResult{
+		Started: time.Now(),
+		Results: make([]ProbeResult, len(w.targets)),
+	}
+
+	type indexedResult struct {
+		index  int
+		result ProbeResult
+	}
+	resultChan := make(chan indexedResult, len(w.targets))
+
+	for i, target := range w.targets {
+		go func() {
+			result := probeBurst(tickCtx, target.Prober, w.burstSize, w.burstInterval, w.probeTimeout)
+			result.Name = target.Name
+			resultChan <- indexedResult{index: i, result: result}
+		}()
+	}
+
+	received := make([]bool, len(w.targets))
+collect:
+	for range w.targets {
+		select {
+		case r := <-resultChan:
+			tick.Results[r.index] = r.result
+			received[r.index] = true
+		case <-tickCtx.Done():
+			break collect
+		}
+	}
+
+	for i, ok := range received {
+		if !ok {
+			// keep the protocol so a dns target that timed out still counts
+			// as a dns failure
+			protocol, target := describe(w.targets[i].Prober)
+			tick.Results[i] = ProbeResult{
+				Name:     w.targets[i].Name,
+				Target:   target,
+				Protocol: protocol,
+				Latency:  time.Since(tick.Started),
+				Err:      tickCtx.Err(),
+				Stats:    newProbeStats(w.burstSize, nil),
+			}
+		}
+	}
+
+	tick.Duration = time.Since(tick.Started)
+	tick.Down = w.quorum.IsDown(w.targets, tick.Results)
+	tick.AverageLatency = averageLatency(tick)
+	tick.Stats = combineStats(tick.Results)
+
+	return tick
+}
+
+// averageLatency averages the targets that answered, falling back to the
+// round duration when none did.
+func averageLatency(tick TickResult) time.Duration {
+	total, count := time.Duration(0), 0
+	for _, result := range tick.Results {
+		if result.Success {
+			total += result.Latency
+			count++
+		}
+	}
+
+	if count == 0 {
+		return tick.Duration
+	}
+	return total / time.Duration(count)
+}
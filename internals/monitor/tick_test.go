@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// sleepyProber ignores its context to simulate a misbehaving probe.
+type sleepyProber struct {
+	delay time.Duration
+}
+
+func (s *sleepyProber) Probe(ctx context.Context) ProbeResult {
+	time.Sleep(s.delay)
+	return ProbeResult{Success: true, Latency: s.delay}
+}
+
+func TestProbeTargets(t *testing.T) {
+	t.Run("Concurrent", func(t *testing.T) {
+		config := Config{
+			CheckInterval: time.Second,
+			TickTimeout:   time.Second,
+			Targets: []Target{
+				{Name: "a", Prober: &sleepyProber{delay: 100 * time.Millisecond}},
+				{Name: "b", Prober: &sleepyProber{delay: 100 * time.Millisecond}},
+				{Name: "c", Prober: &sleepyProber{delay: 100 * time.Millisecond}},
+			},
+		}
+		monitor, err := NewWithConfig(config, nil)
+		if err != nil {
+			t.Fatalf("Failed to create monitor: %v", err)
+		}
+
+		tick := monitor.probeTargets(context.Background())
+		if tick.Duration >= 250*time.Millisecond {
+			t.Errorf("Expected probes to run concurrently, tick took %v", tick.Duration)
+		}
+		if len(tick.Answered()) != 3 {
+			t.Errorf("Expected 3 targets to answer, got: %v", tick.Answered())
+		}
+	})
+
+	t.Run("TickDeadline", func(t *testing.T) {
+		config := Config{
+			CheckInterval: time.Second,
+			TickTimeout:   50 * time.Millisecond,
+			Targets: []Target{
+				{Name: "fast", Prober: &staticProber{result: ProbeResult{Success: true, Latency: time.Millisecond}}},
+				{Name: "stuck", Prober: &sleepyProber{delay: time.Second}},
+			},
+			Quorum: Quorum{DownFraction: 1},
+		}
+		monitor, err := NewWithConfig(config, nil)
+		if err != nil {
+			t.Fatalf("Failed to create monitor: %v", err)
+		}
+
+		tick := monitor.probeTargets(context.Background())
+		if tick.Duration >= 500*time.Millisecond {
+			t.Errorf("Expected tick to be cut off at the deadline, took %v", tick.Duration)
+		}
+
+		stuck := tick.Results[1]
+		if stuck.Success || stuck.Err == nil || stuck.Name != "stuck" {
+			t.Errorf("Expected stuck target to be recorded as failed, got: %+v", stuck)
+		}
+		if tick.Down {
+			t.Errorf("Expected tick to be up with one of two targets answering")
+		}
+		if tick.AverageLatency != time.Millisecond {
+			t.Errorf("Expected average over answering targets, got: %v", tick.AverageLatency)
+		}
+	})
+
+	t.Run("DeadlineKeepsProtocol", func(t *testing.T) {
+		protocol, target := describe(&DNSProber{Host: "example.com", Resolver: "10.0.0.1:53"})
+		if protocol != ProtocolDNS || target != "example.com@10.0.0.1:53" {
+			t.Errorf("Expected the dns target to be described, got %s %s", protocol, target)
+		}
+
+		// a dns target that misses the deadline is a dns failure, not partial
+		tick := TickResult{Results: []ProbeResult{
+			{Name: "fast", Protocol: ProtocolICMP, Success: true, Latency: time.Millisecond},
+			{Name: "dns", Protocol: protocol, Target: target, Err: context.DeadlineExceeded},
+		}}
+		if status := DefaultThresholds().Classify(tick); status != DNSFailure {
+			t.Errorf("Expected a dns failure, got %s", status)
+		}
+	})
+}
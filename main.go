@@ -1,26 +1,94 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"WifiTracker/internals/alerts"
 	"WifiTracker/internals/dashboard"
+	"WifiTracker/internals/db"
 	"WifiTracker/internals/monitor"
 )
 
 func main() {
-	myLogger, err := monitor.NewWifiLogger("log.txt")
+	myLogger, err := monitor.NewWifiLoggerWithOptions("log.txt", monitor.LoggerOptions{
+		Rotation: monitor.RotationOptions{
+			MaxSize:    10 << 20,
+			MaxBackups: 5,
+			Compress:   true,
+		},
+	})
 	if err != nil {
 		panic(err)
 	}
+	defer myLogger.Close()
+
+	database, err := db.NewDatabaseStorage("downtimedata.db")
+	if err != nil {
+		panic(err)
+	}
+	// checks are written in batches off the monitor loop
+	downtimeStorage := db.NewBatchWriter(database, db.DefaultBatchConfig())
+	defer downtimeStorage.Close()
 
 	go func() {
 		log.Println("starting server (please don't block)")
-		dashboard.StartDashboard()
+		dashboard.StartDashboard(downtimeStorage)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// old checks are rolled up in the background, wait for it before closing the db
+	retentionDone := make(chan struct{})
+	go func() {
+		defer close(retentionDone)
+		database.RunRetention(ctx, db.DefaultRetentionConfig())
+	}()
+	defer func() {
+		stop()
+		<-retentionDone
 	}()
 
-	log.Printf("starting monitor")
-	myMonitor := monitor.New(time.Second, myLogger)
-	myMonitor.Start()
+	device, err := monitor.LoadOrCreateDevice("device.json")
+	if err != nil {
+		panic(err)
+	}
+
+	config := monitor.DefaultConfig()
+	config.Device = device
+	config.CheckInterval = time.Second
+	// learn the usual latency from what is already stored
+	config.History = database
+
+	webhookConfig, ok, err := alerts.LoadWebhookConfig("webhooks.json")
+	if err != nil {
+		panic(err)
+	}
+	if ok {
+		webhook, err := alerts.NewWebhookNotifier(webhookConfig)
+		if err != nil {
+			panic(err)
+		}
+		config.Notifiers = append(config.Notifiers, webhook)
+	}
+
+	log.Printf("starting monitor for %s", device.DisplayName())
+	storage := monitor.NewFanOut(
+		monitor.Sink{Name: "log", Storage: myLogger},
+		monitor.Sink{Name: "sqlite", Storage: downtimeStorage},
+	)
+	myMonitor, err := monitor.NewWithConfig(config, storage)
+	if err != nil {
+		panic(err)
+	}
+	if err := myMonitor.Start(ctx); err != nil {
+		log.Printf("monitor stopped with error: %v", err)
+	}
 
+	log.Println("Monitoring stopped by user")
 }
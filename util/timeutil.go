@@ -13,3 +13,9 @@ func OneWeekAgo() time.Time {
 func OneMonthAgo() time.Time {
 	return time.Now().Add(-31 * 24 * time.Hour)
 }
+
+// DurationMs is d in fractional milliseconds, the unit latencies are shown
+// and sent in.
+func DurationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}